@@ -7,11 +7,15 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/Pedro-Foramilio/social/internal/auth"
+	"github.com/Pedro-Foramilio/social/internal/blob"
 	"github.com/Pedro-Foramilio/social/internal/mailer"
+	"github.com/Pedro-Foramilio/social/internal/presence"
+	"github.com/Pedro-Foramilio/social/internal/pubsub"
 	ratelimiter "github.com/Pedro-Foramilio/social/internal/rateLimiter"
 	"github.com/Pedro-Foramilio/social/internal/store"
 	"github.com/Pedro-Foramilio/social/internal/store/cache"
@@ -31,6 +35,14 @@ type application struct {
 	mailer        mailer.Client
 	authenticator auth.Authenticator
 	rateLimiter   ratelimiter.Limiter
+	blobStorage   blob.Storage
+	broker        pubsub.Broker
+	presence      presence.Tracker
+	wsLimiter     ratelimiter.Limiter
+	background    sync.WaitGroup
+	// closing is closed when the server starts shutting down, to end the
+	// long-lived event streams that srv.Shutdown does not interrupt.
+	closing chan struct{}
 }
 
 type config struct {
@@ -42,6 +54,80 @@ type config struct {
 	auth        authConfig
 	redisCfg    redisConfig
 	rateLimiter ratelimiter.Config
+	trash       trashConfig
+	publisher   publisherConfig
+	reactions   reactionsConfig
+	attachments attachmentsConfig
+	trending    trendingConfig
+	explore     exploreConfig
+	comments    commentsConfig
+	feed        feedConfig
+	events      eventsConfig
+	ws          wsConfig
+}
+
+type wsConfig struct {
+	// maxTopics is how many topics a connection may subscribe to.
+	maxTopics int
+	// rateLimiter limits the messages each connection may send.
+	rateLimiter ratelimiter.Config
+}
+
+type eventsConfig struct {
+	// heartbeat is the interval of the keep-alive comments sent on idle
+	// event streams.
+	heartbeat time.Duration
+	// buffer is how many events a stream may fall behind by before it is
+	// dropped.
+	buffer int
+}
+
+type feedConfig struct {
+	// cursorSecret signs the feed cursors handed out to clients.
+	cursorSecret string
+	// fanOutMaxFollowers is the follower count above which posts are not
+	// pushed into the followers' timelines.
+	fanOutMaxFollowers int
+	// ranking weighs the signals behind the top feed (sort=top).
+	ranking store.FeedRanking
+}
+
+type commentsConfig struct {
+	maxDepth int
+	// editWindow is how long after posting authors may edit a comment.
+	editWindow time.Duration
+}
+
+type exploreConfig struct {
+	cacheTTL time.Duration
+}
+
+type trendingConfig struct {
+	windows       map[string]time.Duration
+	defaultWindow string
+	pruneInterval time.Duration
+}
+
+type attachmentsConfig struct {
+	dir           string
+	thumbnailSize int
+	maxBytes      map[string]int64
+	orphanTTL     time.Duration
+	gcInterval    time.Duration
+}
+
+type reactionsConfig struct {
+	types []string
+}
+
+type publisherConfig struct {
+	interval  time.Duration
+	batchSize int
+}
+
+type trashConfig struct {
+	retention     time.Duration
+	purgeInterval time.Duration
 }
 
 type redisConfig struct {
@@ -95,8 +181,8 @@ func (app *application) mount() http.Handler {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"}, //specify allowed origins, e.g. "https://example.com"
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
@@ -106,24 +192,81 @@ func (app *application) mount() http.Handler {
 		r.With(app.BasicAuthMiddleware()).Get("/health", app.healthCheckHandler)
 		r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
 
+		r.With(app.AuthTokenMiddleware).Get("/ws", app.wsHandler)
+
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
 
 			r.Post("/", app.createPostHandler)
 
+			r.Get("/drafts", app.getDraftsHandler)
+			r.Get("/scheduled", app.getScheduledHandler)
+			r.Get("/trash", app.getTrashHandler)
+			r.Put("/trash/{postID}/restore", app.restorePostHandler)
+
 			r.Route("/{postID}", func(r chi.Router) {
 				r.Use(app.postsContextMiddleware)
 
 				r.Get("/", app.getPostHandler)
+				r.Get("/comments", app.getPostCommentsHandler)
 				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
 				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+
+				r.Put("/reactions", app.setPostReactionHandler)
+				r.Delete("/reactions", app.removePostReactionHandler)
+
+				r.Put("/bookmark", app.bookmarkPostHandler)
+				r.Delete("/bookmark", app.removeBookmarkHandler)
+
+				r.Post("/reposts", app.repostHandler)
+				r.Delete("/reposts", app.deleteRepostHandler)
+
+				r.Post("/poll/votes", app.votePollHandler)
+
+				r.Put("/pin", app.pinPostHandler)
+				r.Delete("/pin", app.unpinPostHandler)
 			})
 
 		})
 
+		r.Route("/attachments", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Post("/", app.uploadAttachmentHandler)
+			r.Get("/{attachmentID}/content", app.getAttachmentContentHandler)
+			r.Get("/{attachmentID}/thumbnail", app.getAttachmentThumbnailHandler)
+		})
+
+		r.With(app.OptionalAuthTokenMiddleware).Get("/explore", app.getExploreHandler)
+		r.With(app.OptionalAuthTokenMiddleware).Get("/search", app.searchHandler)
+
+		r.Route("/tags", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+
+				r.Get("/trending", app.getTrendingTagsHandler)
+				r.Get("/{tag}/posts", app.getTagPostsHandler)
+			})
+
+			r.Get("/{tag}/feed.rss", app.getTagSyndicationHandler(feedFormatRSS))
+			r.Get("/{tag}/feed.atom", app.getTagSyndicationHandler(feedFormatAtom))
+			r.Get("/{tag}/feed.json", app.getTagSyndicationHandler(feedFormatJSON))
+		})
+
 		r.Route("/comments", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
 			r.Post("/", app.createCommentHandler)
+
+			r.Route("/{commentID}", func(r chi.Router) {
+				r.Use(app.commentsContextMiddleware)
+
+				r.Patch("/", app.checkCommentOwnership("moderator", app.updateCommentHandler))
+				r.Delete("/", app.checkCommentOwnership("moderator", app.deleteCommentHandler))
+				r.Get("/replies", app.getCommentRepliesHandler)
+
+				r.Put("/reactions", app.setCommentReactionHandler)
+				r.Delete("/reactions", app.removeCommentReactionHandler)
+			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
@@ -132,13 +275,38 @@ func (app *application) mount() http.Handler {
 				r.Put("/", app.activateUserHandler)
 			})
 
-			r.Route("/{userID}", func(r chi.Router) {
+			r.Route("/me", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 
-				r.Get("/", app.getUserHandler)
+				r.Get("/events", app.streamEventsHandler)
 
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				r.Route("/bookmarks", func(r chi.Router) {
+					r.Get("/", app.getBookmarksHandler)
+					r.Get("/collections", app.getBookmarkCollectionsHandler)
+					r.Post("/collections", app.createBookmarkCollectionHandler)
+					r.Delete("/collections/{collectionID}", app.deleteBookmarkCollectionHandler)
+				})
+			})
+
+			r.Route("/{userID}", func(r chi.Router) {
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Use(app.userContextMiddleware)
+
+					r.Get("/", app.getUserHandler)
+					r.Get("/posts", app.getUserPostsHandler)
+
+					r.Put("/follow", app.followUserHandler)
+					r.Put("/unfollow", app.unfollowUserHandler)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.userContextMiddleware)
+
+					r.Get("/feed.rss", app.getUserSyndicationHandler(feedFormatRSS))
+					r.Get("/feed.atom", app.getUserSyndicationHandler(feedFormatAtom))
+					r.Get("/feed.json", app.getUserSyndicationHandler(feedFormatJSON))
+				})
 			})
 
 			r.Group(func(r chi.Router) {
@@ -168,11 +336,19 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	app.closing = make(chan struct{})
+	srv.RegisterOnShutdown(func() { close(app.closing) })
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	app.startBackgroundJobs(jobsCtx)
+
 	shutdown := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 		s := <-quit
+		stopJobs()
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		app.logger.Infow("Shutting down server", "signal", s.String())
@@ -192,6 +368,8 @@ func (app *application) run(mux http.Handler) error {
 		return err
 	}
 
+	app.background.Wait()
+
 	app.logger.Infow("Server stopped")
 
 	return nil
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/blob"
+	"github.com/Pedro-Foramilio/social/internal/media"
+	"github.com/Pedro-Foramilio/social/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (app *application) uploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	maxBytes := app.attachmentSizeLimit(user)
+
+	// leave some room for the multipart envelope around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			app.payloadTooLargeResponse(w, r, err)
+			return
+		}
+		app.badRequestResponse(w, r, fmt.Errorf("missing multipart file field %q: %w", "file", err))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if int64(len(data)) > maxBytes {
+		app.payloadTooLargeResponse(w, r, fmt.Errorf("attachment exceeds %d bytes", maxBytes))
+		return
+	}
+
+	img, err := media.Process(data, app.config.attachments.thumbnailSize)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrUnsupportedType):
+			app.unsupportedMediaTypeResponse(w, r, err)
+		case errors.Is(err, media.ErrTooLarge):
+			app.payloadTooLargeResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	ctx := r.Context()
+	key := "attachments/" + uuid.New().String()
+
+	attachment := &store.Attachment{
+		UserID:       user.ID,
+		StorageKey:   key,
+		ThumbnailKey: key + "_thumb",
+		ContentType:  img.ContentType,
+		Size:         int64(len(img.Data)),
+		Width:        img.Width,
+		Height:       img.Height,
+	}
+
+	if err := app.blobStorage.Put(ctx, attachment.StorageKey, bytes.NewReader(img.Data), img.ContentType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.blobStorage.Put(ctx, attachment.ThumbnailKey, bytes.NewReader(img.Thumbnail), img.ContentType); err != nil {
+		app.deleteBlobs(attachment)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Attachments.Create(ctx, attachment); err != nil {
+		app.deleteBlobs(attachment)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, attachment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getAttachmentContentHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveAttachment(w, r, false)
+}
+
+func (app *application) getAttachmentThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveAttachment(w, r, true)
+}
+
+func (app *application) serveAttachment(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	attachmentID, err := strconv.ParseInt(chi.URLParam(r, "attachmentID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	attachment, err := app.store.Attachments.GetByID(ctx, attachmentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	visible, err := app.canViewAttachment(ctx, attachment, getUserFromContext(r))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !visible {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	key := attachment.StorageKey
+	if thumbnail {
+		key = attachment.ThumbnailKey
+	}
+
+	content, err := app.blobStorage.Get(ctx, key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=86400, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, content); err != nil {
+		app.logger.Warnw("error streaming attachment", "attachmentID", attachment.ID, "error", err)
+	}
+}
+
+// canViewAttachment reports whether user may download the attachment: its
+// uploader always can, everyone else only when the post it belongs to is
+// published, not deleted and visible to them.
+func (app *application) canViewAttachment(ctx context.Context, attachment *store.Attachment, user *store.User) (bool, error) {
+	if attachment.UserID == user.ID {
+		return true, nil
+	}
+	if attachment.PostID == nil {
+		return false, nil
+	}
+	return app.store.Posts.CanViewPublished(ctx, *attachment.PostID, user.ID)
+}
+
+// attachmentSizeLimit returns the largest upload allowed for the user's role.
+func (app *application) attachmentSizeLimit(user *store.User) int64 {
+	if limit, ok := app.config.attachments.maxBytes[user.Role.Name]; ok {
+		return limit
+	}
+	return app.config.attachments.maxBytes["user"]
+}
+
+func (app *application) deleteBlobs(attachment *store.Attachment) {
+	// use a fresh context: the request may already be cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+		if err := app.blobStorage.Delete(ctx, key); err != nil {
+			app.logger.Errorw("error deleting attachment blob", "key", key, "error", err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type BookmarkPostPayload struct {
+	CollectionID *int64 `json:"collection_id"`
+}
+
+type CreateBookmarkCollectionPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type BookmarksPage struct {
+	Bookmarks  []store.Bookmark `json:"bookmarks"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+func (app *application) bookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	var payload BookmarkPostPayload
+
+	// the body is optional: an empty PUT bookmarks the post without a collection
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	post := getPostsFromCtx(r)
+	user := getUserFromContext(r)
+
+	if err := app.store.Bookmarks.Add(r.Context(), user.ID, post.ID, payload.CollectionID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) removeBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostsFromCtx(r)
+	user := getUserFromContext(r)
+
+	if err := app.store.Bookmarks.Remove(r.Context(), user.ID, post.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) getBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if fq.Cursor != "" {
+		fq.Position, err = app.parseFeedCursor(fq.Cursor)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	bq := store.BookmarkQuery{PaginatedFeedQuery: fq}
+
+	if collection := r.URL.Query().Get("collection_id"); collection != "" {
+		collectionID, err := strconv.ParseInt(collection, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		bq.CollectionID = &collectionID
+	}
+
+	// fetch one extra row to know whether there is a next page
+	bq.Limit = fq.Limit + 1
+
+	user := getUserFromContext(r)
+
+	bookmarks, err := app.store.Bookmarks.List(r.Context(), user.ID, bq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	page := BookmarksPage{Bookmarks: bookmarks}
+	if len(bookmarks) > fq.Limit {
+		page.Bookmarks = bookmarks[:fq.Limit]
+		last := page.Bookmarks[fq.Limit-1]
+		page.NextCursor = app.signFeedCursor(store.FeedCursor{Cursor: store.Cursor{CreatedAt: last.BookmarkedAt, ID: last.ID}})
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getBookmarkCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	collections, err := app.store.Bookmarks.GetCollections(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collections); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) createBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateBookmarkCollectionPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	collection := &store.BookmarkCollection{
+		UserID: user.ID,
+		Name:   payload.Name,
+	}
+
+	if err := app.store.Bookmarks.CreateCollection(r.Context(), collection); err != nil {
+		switch {
+		case errors.Is(err, store.ErrAlredyExists):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, collection); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collectionID, err := strconv.ParseInt(chi.URLParam(r, "collectionID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Bookmarks.DeleteCollection(r.Context(), user.ID, collectionID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,14 +1,36 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/Pedro-Foramilio/social/internal/store"
+	"github.com/go-chi/chi/v5"
 )
 
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
+type CommentsPage struct {
+	Comments   []store.Comment `json:"comments"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
 type CreateCommentPayload struct {
-	PostID  int64  `json:"post_id" validate:"required"`
-	Content string `json:"content" validate:"required,max=500"`
+	PostID        int64  `json:"post_id" validate:"required"`
+	ParentID      *int64 `json:"parent_id"`
+	Content       string `json:"content" validate:"required,max=500"`
+	ContentFormat string `json:"content_format" validate:"omitempty,oneof=plain markdown"`
+}
+
+type UpdateCommentPayload struct {
+	Content       *string `json:"content" validate:"omitempty,max=500"`
+	ContentFormat *string `json:"content_format" validate:"omitempty,oneof=plain markdown"`
 }
 
 func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -24,17 +46,78 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	ctx := r.Context()
 	user := getUserFromContext(r)
-	comment := &store.Comment{
-		PostID:  payload.PostID,
-		Content: payload.Content,
-		UserID:  user.ID,
+
+	post, err := app.store.Posts.GetByID(ctx, payload.PostID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
 	}
 
-	if err := app.store.Comments.Create(r.Context(), comment); err != nil {
+	visible, err := app.store.Posts.CanView(ctx, post.ID, user.ID)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	if post.Status != store.PostStatusPublished || !visible {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	var parent *store.Comment
+	if payload.ParentID != nil {
+		parent, err = app.store.Comments.GetByID(ctx, *payload.ParentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if parent.Depth+1 > app.config.comments.maxDepth {
+			app.badRequestResponse(w, r, fmt.Errorf("replies cannot be nested more than %d levels deep", app.config.comments.maxDepth))
+			return
+		}
+	}
+
+	comment := &store.Comment{
+		PostID:        payload.PostID,
+		ParentID:      payload.ParentID,
+		Content:       payload.Content,
+		ContentFormat: payload.ContentFormat,
+		UserID:        user.ID,
+	}
+
+	if err := app.store.Comments.Create(ctx, comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrCommentsRestricted):
+			app.commentsRestrictedResponse(w, r, post.CommentPolicy)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	live := *comment
+	live.User = store.User{ID: user.ID, Username: user.Username}
+	app.streamComment(ctx, &live)
+	if post.UserID != user.ID {
+		app.publishEvent(ctx, []int64{post.UserID}, eventComment, live)
+	}
+	if parent != nil {
+		app.notify(ctx, parent.UserID, user, Notification{Kind: NotificationReply, PostID: post.ID, CommentID: comment.ID})
+	}
 
 	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
 		app.internalServerError(w, r, err)
@@ -42,3 +125,211 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 }
+
+// getPostCommentsHandler lists the top-level comments of the post.
+func (app *application) getPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostsFromCtx(r)
+
+	app.listComments(w, r, store.CommentQuery{PostID: post.ID})
+}
+
+// getCommentRepliesHandler lists the direct replies to a comment.
+func (app *application) getCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	app.listComments(w, r, store.CommentQuery{PostID: comment.PostID, ParentID: &comment.ID})
+}
+
+// listComments reads the sort, limit, cursor and user_id query parameters
+// into cq and writes the matching page of comments.
+func (app *application) listComments(w http.ResponseWriter, r *http.Request, cq store.CommentQuery) {
+	qs := r.URL.Query()
+
+	cq.Sort = store.CommentSortOldest
+	if sort := qs.Get("sort"); sort != "" {
+		cq.Sort = sort
+	}
+
+	cq.Limit = 20
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		cq.Limit = l
+	}
+
+	if userID := qs.Get("user_id"); userID != "" {
+		id, err := strconv.ParseInt(userID, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		cq.UserID = id
+	}
+
+	cq.Cursor = qs.Get("cursor")
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	page, err := app.getCommentsPage(r.Context(), cq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getCommentsPage returns up to cq.Limit comments, with the cursor of the
+// next page when there is one.
+func (app *application) getCommentsPage(ctx context.Context, cq store.CommentQuery) (CommentsPage, error) {
+	limit := cq.Limit
+	// fetch one extra row to know whether there is a next page
+	cq.Limit++
+
+	comments, err := app.store.Comments.List(ctx, cq)
+	if err != nil {
+		return CommentsPage{}, err
+	}
+
+	page := CommentsPage{Comments: comments}
+	if len(comments) > limit {
+		page.Comments = comments[:limit]
+		page.NextCursor = store.CommentCursorFor(&page.Comments[limit-1]).Encode()
+	}
+
+	return page, nil
+}
+
+// updateCommentHandler edits a comment. Authors may only edit within the
+// configured edit window; moderators are not bound by it.
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+	user := getUserFromContext(r)
+
+	if comment.UserID == user.ID {
+		createdAt, err := time.Parse(time.RFC3339Nano, comment.CreatedAt)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if time.Since(createdAt) > app.config.comments.editWindow {
+			app.forbiddenErrorResponse(w, r, fmt.Errorf("comments can only be edited within %s of posting", app.config.comments.editWindow))
+			return
+		}
+	}
+
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.Content != nil {
+		comment.Content = *payload.Content
+	}
+	if payload.ContentFormat != nil {
+		comment.ContentFormat = *payload.ContentFormat
+	}
+
+	if comment.Content == "" {
+		app.badRequestResponse(w, r, fmt.Errorf("content is required"))
+		return
+	}
+
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	if err := app.store.Comments.Delete(r.Context(), comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commentsContextMiddleware loads the comment of the route. Comments on posts
+// the viewer may not see are reported as missing.
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		comment, err := app.store.Comments.GetByID(ctx, commentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		visible, err := app.store.Posts.CanView(ctx, comment.PostID, getUserFromContext(r).ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !visible {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *store.Comment {
+	comment, ok := r.Context().Value(commentCtx).(*store.Comment)
+	if !ok {
+		return nil
+	}
+	return comment
+}
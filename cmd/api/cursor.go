@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+)
+
+// Feed cursors are the JSON encoded store.FeedCursor followed by its
+// HMAC-SHA256, so clients can hold on to them but not forge positions. The
+// tag and bookmark listings hand out the same cursors.
+
+func (app *application) signFeedCursor(c store.FeedCursor) string {
+	data, _ := json.Marshal(c)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(app.feedCursorMAC(payload))
+}
+
+func (app *application) parseFeedCursor(value string) (*store.FeedCursor, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, store.ErrInvalidCursor
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, app.feedCursorMAC(payload)) {
+		return nil, store.ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, store.ErrInvalidCursor
+	}
+
+	var c store.FeedCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, store.ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+func (app *application) feedCursorMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(app.config.feed.cursorSecret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
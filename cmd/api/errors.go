@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -15,6 +18,12 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 
 	app.logger.Warnw("bad request error", "method", r.Method, "path", r.URL.Path, "error", err)
 
+	var fields store.FieldErrors
+	if errors.As(err, &fields) {
+		writeJSONFieldErrors(w, http.StatusBadRequest, "invalid query parameters", fields)
+		return
+	}
+
 	writeJSONError(w, http.StatusBadRequest, err.Error())
 }
 
@@ -32,6 +41,27 @@ func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request,
 	writeJSONError(w, http.StatusConflict, err.Error())
 }
 
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+
+	app.logger.Warnw("precondition failed", "method", r.Method, "path", r.URL.Path, "error", err)
+
+	writeJSONError(w, http.StatusPreconditionFailed, err.Error())
+}
+
+func (app *application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, err error) {
+
+	app.logger.Warnw("payload too large", "method", r.Method, "path", r.URL.Path, "error", err)
+
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, err error) {
+
+	app.logger.Warnw("unsupported media type", "method", r.Method, "path", r.URL.Path, "error", err)
+
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
+
 func (app *application) unauthorizedBasicErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 
 	app.logger.Warnw("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err)
@@ -61,3 +91,19 @@ func (app *application) rateLimiterExceededResponse(w http.ResponseWriter, r *ht
 	w.Header().Set("Retry-After", retryAfter)
 	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
 }
+
+func (app *application) commentsRestrictedResponse(w http.ResponseWriter, r *http.Request, policy string) {
+
+	app.logger.Warnw("comments restricted", "method", r.Method, "path", r.URL.Path, "policy", policy)
+
+	switch policy {
+	case store.CommentPolicyLocked:
+		writeJSONErrorCode(w, http.StatusForbidden, "comments_locked", "comments on this post are locked")
+	case store.CommentPolicyFollowers:
+		writeJSONErrorCode(w, http.StatusForbidden, "comments_followers_only", "only followers of the author can comment on this post")
+	case store.CommentPolicyMentioned:
+		writeJSONErrorCode(w, http.StatusForbidden, "comments_mentioned_only", "only users mentioned in this post can comment on it")
+	default:
+		writeJSONErrorCode(w, http.StatusForbidden, "comments_restricted", store.ErrCommentsRestricted.Error())
+	}
+}
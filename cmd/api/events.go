@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+)
+
+// Live events are published on the broker channel of each user concerned,
+// so that they reach that user's streams on any API instance. They are not
+// stored: clients catch up with the regular endpoints after reconnecting.
+
+const (
+	eventPost         = "post"
+	eventComment      = "comment"
+	eventNotification = "notification"
+)
+
+const (
+	NotificationFollow   = "follow"
+	NotificationMention  = "mention"
+	NotificationReaction = "reaction"
+	NotificationReply    = "reply"
+)
+
+// streamWriteTimeout bounds each write to an event stream, in place of
+// srv.WriteTimeout which would end the stream.
+const streamWriteTimeout = 10 * time.Second
+
+type streamEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+	// Sender is the user behind events that are not sent back to them,
+	// like typing indicators.
+	Sender int64 `json:"sender,omitempty"`
+}
+
+// Actor is the user behind a notification or a typing indicator.
+type Actor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// Notification tells a user about someone else's action concerning them.
+type Notification struct {
+	Kind      string    `json:"kind"`
+	Actor     Actor     `json:"actor"`
+	PostID    int64     `json:"post_id,omitempty"`
+	CommentID int64     `json:"comment_id,omitempty"`
+	Reaction  string    `json:"reaction,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func userEventsChannel(userID int64) string {
+	return fmt.Sprintf("user-events-%d", userID)
+}
+
+// publishEvent sends an event to the streams of userIDs.
+func (app *application) publishEvent(ctx context.Context, userIDs []int64, eventType string, data any) {
+	channels := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		channels[i] = userEventsChannel(id)
+	}
+
+	app.publish(ctx, channels, streamEvent{Type: eventType}, data)
+}
+
+// publish sends ev with data on the broker channels. Failures are logged:
+// live events are best effort.
+func (app *application) publish(ctx context.Context, channels []string, ev streamEvent, data any) {
+	if len(channels) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err == nil {
+		ev.Data = payload
+		payload, err = json.Marshal(ev)
+	}
+	if err != nil {
+		app.logger.Errorw("error encoding event", "type", ev.Type, "error", err)
+		return
+	}
+
+	if err := app.broker.Publish(context.WithoutCancel(ctx), payload, channels...); err != nil {
+		app.logger.Errorw("error publishing event", "type", ev.Type, "error", err)
+	}
+}
+
+// notify sends a notification from actor to userID, unless it is about the
+// actor's own action.
+func (app *application) notify(ctx context.Context, userID int64, actor *store.User, n Notification) {
+	if userID == actor.ID {
+		return
+	}
+
+	n.Actor = Actor{ID: actor.ID, Username: actor.Username}
+	n.CreatedAt = time.Now().UTC()
+
+	app.publishEvent(ctx, []int64{userID}, eventNotification, n)
+}
+
+// streamBatch is how many followers are read and published to at once when
+// streaming a post.
+const streamBatch = 1000
+
+// streamPost sends a post that just went live, as a feed item, to the
+// streams of its author and of every follower who may see it, and notifies
+// the users it mentions. Followers are walked in batches, however many there
+// are, so it is meant to run in the background; the walk stops when the
+// server shuts down, as live events would reach no stream by then.
+func (app *application) streamPost(ctx context.Context, postID int64) {
+	items, err := app.store.Posts.GetByIDs(ctx, []int64{postID})
+	if err == nil && len(items) == 0 {
+		return
+	}
+	if err == nil {
+		err = app.store.Posts.Hydrate(ctx, 0, &items[0].Post)
+	}
+	if err != nil {
+		app.logger.Errorw("error streaming post", "post", postID, "error", err)
+		return
+	}
+	item := &items[0]
+
+	mentioned, err := app.store.Posts.GetMentionedIDs(ctx, postID)
+	if err == nil {
+		mentioned, err = app.store.Posts.FilterViewers(ctx, postID, mentioned)
+	}
+	if err != nil {
+		app.logger.Errorw("error streaming post", "post", postID, "error", err)
+		return
+	}
+
+	for _, id := range mentioned {
+		app.notify(ctx, id, &item.User, Notification{Kind: NotificationMention, PostID: postID})
+	}
+
+	app.publishEvent(ctx, []int64{item.UserID}, eventPost, item)
+	if item.Visibility == store.VisibilityPrivate {
+		return
+	}
+
+	var after int64
+	for {
+		select {
+		case <-app.closing:
+			return
+		default:
+		}
+
+		followers, err := app.store.Followers.GetFollowerIDsAfter(ctx, item.UserID, after, streamBatch)
+		if err == nil {
+			followers, err = app.store.Posts.FilterViewers(ctx, postID, followers)
+		}
+		if err != nil {
+			app.logger.Errorw("error streaming post", "post", postID, "error", err)
+			return
+		}
+
+		app.publishEvent(ctx, followers, eventPost, item)
+
+		if len(followers) < streamBatch {
+			return
+		}
+		after = followers[len(followers)-1]
+	}
+}
+
+// streamEventsHandler streams the live events of the authenticated user as
+// Server-Sent Events: new feed posts, comments on their posts and
+// notifications. The stream ends when the client goes away, falls too far
+// behind, or the server shuts down.
+func (app *application) streamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	sub, err := app.broker.Subscribe(ctx, userEventsChannel(user.ID))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+
+	write := func(s string) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, s); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// keeps reverse proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := write("retry: 5000\n\n"); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.events.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.closing:
+			return
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				return
+			}
+
+			var ev streamEvent
+			if err := json.Unmarshal(msg.Data, &ev); err != nil {
+				app.logger.Errorw("error decoding event", "error", err)
+				continue
+			}
+			err = write("event: " + ev.Type + "\ndata: " + string(ev.Data) + "\n\n")
+		case <-heartbeat.C:
+			err = write(": ping\n\n")
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
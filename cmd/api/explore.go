@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+)
+
+// getExploreHandler lists public posts across all users. Anonymous requests,
+// and authenticated ones sent with personalize=false, get no viewer specific
+// data (reactions, bookmarks, poll votes) and are served from Redis when the
+// cache is enabled.
+func (app *application) getExploreHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// explore is paged by offset and hands out no cursors
+	if fq.Cursor != "" {
+		app.badRequestResponse(w, r, store.FieldErrors{"cursor": "not supported on this endpoint"})
+		return
+	}
+
+	qs := r.URL.Query()
+
+	eq := store.ExploreQuery{PaginatedFeedQuery: fq, Ranking: store.RankingLatest}
+	if ranking := qs.Get("ranking"); ranking != "" {
+		eq.Ranking = ranking
+	}
+
+	if err := Validate.Struct(eq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	window := qs.Get("window")
+	if window != "" && eq.Since != "" {
+		app.badRequestResponse(w, r, fmt.Errorf("window and since cannot be combined"))
+		return
+	}
+	if window == "" && eq.Since == "" && eq.Ranking == store.RankingEngagement {
+		window = app.config.trending.defaultWindow
+	}
+
+	// the key names the window rather than the moving since it resolves to
+	cacheKey := exploreCacheKey(eq, window)
+
+	if window != "" {
+		duration, ok := app.config.trending.windows[window]
+		if !ok {
+			app.badRequestResponse(w, r, fmt.Errorf("unknown window %q", window))
+			return
+		}
+		eq.Since = time.Now().Add(-duration).UTC().Format(time.RFC3339)
+	}
+
+	var viewerID int64
+	if user := getUserFromContext(r); user != nil && qs.Get("personalize") != "false" {
+		viewerID = user.ID
+	}
+
+	ctx := r.Context()
+	cacheable := viewerID == 0 && app.config.redisCfg.enabled
+
+	if cacheable {
+		posts, err := app.cacheStorage.Explore.Get(ctx, cacheKey)
+		if err == nil {
+			if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	posts, err := app.store.Posts.GetExplore(ctx, viewerID, eq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if cacheable {
+		if err := app.cacheStorage.Explore.Set(ctx, cacheKey, posts, app.config.explore.cacheTTL); err != nil {
+			app.logger.Errorw("error setting explore cache", "error", err)
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func exploreCacheKey(eq store.ExploreQuery, window string) string {
+	key := strings.Join([]string{
+		eq.Ranking,
+		window,
+		fmt.Sprint(eq.Limit),
+		fmt.Sprint(eq.Offset),
+		eq.Sort,
+		strings.Join(eq.Tags, ","),
+		eq.Search,
+		eq.Since,
+		eq.Until,
+	}, "\x00")
+
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/Pedro-Foramilio/social/internal/store"
 )
@@ -20,20 +24,195 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// only the feed can be ranked; the query is otherwise validated like
+	// the other timelines
+	top := fq.Sort == store.FeedSortTop
+	if top {
+		fq.Sort = "desc"
+	}
+
 	if err := Validate.Struct(fq); err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
+	if fq.Cursor != "" {
+		fq.Position, err = app.parseFeedCursor(fq.Cursor)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	} else if fq.Offset > 0 {
+		// offset pagination is kept for older clients only
+		w.Header().Set("Deprecation", "true")
+	}
+
+	limit := fq.Limit
+	// fetch one extra row to know whether there is another page
+	fq.Limit++
+
+	user := getUserFromContext(r)
+
 	ctx := r.Context()
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(102), fq)
+
+	if top {
+		app.getTopFeed(w, r, user.ID, fq, limit)
+		return
+	}
+
+	var feed []store.PostWithMetadata
+	materialized := false
+
+	if app.config.redisCfg.enabled && canMaterializeFeed(fq) {
+		feed, materialized, err = app.getMaterializedFeed(ctx, user.ID, fq)
+		if err != nil {
+			app.logger.Errorw("error reading materialized feed", "user", user.ID, "error", err)
+			materialized = false
+		}
+	}
+
+	if !materialized {
+		feed, err = app.store.Posts.GetUserFeed(ctx, user.ID, fq)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	prev := fq.Position != nil && fq.Position.Prev
+	more := len(feed) > limit
+
+	if more {
+		// backward pages come in feed order, so the extra row is the first
+		if prev {
+			feed = feed[1:]
+		} else {
+			feed = feed[:limit]
+		}
+	}
+
+	page := PostsPage{Posts: feed}
+	if len(feed) > 0 {
+		if more || prev {
+			page.NextCursor = app.signFeedCursor(store.FeedCursor{Cursor: store.CursorFor(&feed[len(feed)-1].Post)})
+		}
+		if (more && prev) || (!prev && (fq.Position != nil || fq.Offset > 0)) {
+			page.PrevCursor = app.signFeedCursor(store.FeedCursor{Cursor: store.CursorFor(&feed[0].Post), Prev: true})
+		}
+	}
+
+	setPageLinks(w, r, page.NextCursor, page.PrevCursor)
+
+	err = app.jsonResponse(w, http.StatusOK, page)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+}
+
+// getTopFeed responds with a page of the feed ranked by score. Pages of the
+// top feed are only linked forward, and are all scored as of the time the
+// first one was requested.
+func (app *application) getTopFeed(w http.ResponseWriter, r *http.Request, userID int64, fq store.PaginatedFeedQuery, limit int) {
+	at := time.Now()
+	if fq.Position != nil && fq.Position.Rank != nil {
+		at = fq.Position.Rank.At
+	}
 
-	err = app.jsonResponse(w, http.StatusOK, feed)
+	feed, err := app.store.Posts.GetTopFeed(r.Context(), userID, fq, app.config.feed.ranking, at)
 	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	page := PostsPage{Posts: feed}
+	if len(feed) > limit {
+		page.Posts = feed[:limit]
+
+		last := page.Posts[limit-1]
+		page.NextCursor = app.signFeedCursor(store.FeedCursor{
+			Cursor: store.CursorFor(&last.Post),
+			Rank:   &store.FeedRank{Score: *last.Score, At: at},
+		})
+	}
+
+	setPageLinks(w, r, page.NextCursor, "")
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// setPageLinks sets the Link header to the request URL with the given
+// cursors, for the cursors that are not empty.
+func setPageLinks(w http.ResponseWriter, r *http.Request, next, prev string) {
+	var links []string
+
+	for _, link := range []struct{ rel, cursor string }{{"next", next}, {"prev", prev}} {
+		if link.cursor == "" {
+			continue
+		}
+
+		qs := r.URL.Query()
+		qs.Del("offset")
+		qs.Set("cursor", link.cursor)
+
+		u := url.URL{Path: r.URL.Path, RawQuery: qs.Encode()}
+		links = append(links, `<`+u.String()+`>; rel="`+link.rel+`"`)
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// getUserPostsHandler returns the profile timeline of the user loaded by
+// userContextMiddleware, as seen by the authenticated user.
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// the profile timeline is paged by offset and hands out no cursors
+	if fq.Cursor != "" {
+		app.badRequestResponse(w, r, store.FieldErrors{"cursor": "not supported on this endpoint"})
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	viewer := getUserFromContext(r)
+	author := getProfileUserFromCtx(r)
+
+	posts, err := app.store.Posts.GetUserPosts(r.Context(), viewer.ID, author.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
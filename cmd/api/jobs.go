@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+func (app *application) startBackgroundJobs(ctx context.Context) {
+	app.runPeriodic(ctx, "trash purge", app.config.trash.purgeInterval, app.purgeTrash)
+	app.runPeriodic(ctx, "scheduled publisher", app.config.publisher.interval, app.publishScheduledPosts)
+	app.runPeriodic(ctx, "attachment gc", app.config.attachments.gcInterval, app.collectOrphanAttachments)
+	app.runPeriodic(ctx, "tag usage prune", app.config.trending.pruneInterval, app.pruneTagUsage)
+}
+
+// runPeriodic runs fn every interval in its own goroutine until ctx is cancelled.
+func (app *application) runPeriodic(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	app.background.Add(1)
+
+	go func() {
+		defer app.background.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := fn(ctx); err != nil {
+					app.logger.Errorw("background job failed", "job", name, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+func (app *application) purgeTrash(ctx context.Context) error {
+	deletedBefore := time.Now().Add(-app.config.trash.retention)
+
+	purged, err := app.store.Posts.PurgeDeleted(ctx, deletedBefore)
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		app.logger.Infow("purged deleted posts", "count", purged)
+	}
+	return nil
+}
+
+func (app *application) publishScheduledPosts(ctx context.Context) error {
+	for {
+		ids, err := app.store.Posts.PublishScheduled(ctx, app.config.publisher.batchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) > 0 {
+			app.logger.Infow("published scheduled posts", "ids", ids)
+		}
+
+		if len(ids) > 0 {
+			posts, err := app.store.Posts.GetByIDs(ctx, ids)
+			if err != nil {
+				return err
+			}
+
+			for i := range posts {
+				app.publishToTimelines(ctx, &posts[i].Post, true)
+			}
+		}
+
+		if len(ids) < app.config.publisher.batchSize {
+			return nil
+		}
+	}
+}
+
+func (app *application) collectOrphanAttachments(ctx context.Context) error {
+	createdBefore := time.Now().Add(-app.config.attachments.orphanTTL)
+
+	orphans, err := app.store.Attachments.DeleteOrphans(ctx, createdBefore, 100)
+	if err != nil {
+		return err
+	}
+
+	for i := range orphans {
+		app.deleteBlobs(&orphans[i])
+	}
+
+	if len(orphans) > 0 {
+		app.logger.Infow("collected orphan attachments", "count", len(orphans))
+	}
+	return nil
+}
+
+// pruneTagUsage drops usage buckets that fall outside the longest trending
+// window.
+func (app *application) pruneTagUsage(ctx context.Context) error {
+	var retention time.Duration
+	for _, window := range app.config.trending.windows {
+		retention = max(retention, window)
+	}
+
+	pruned, err := app.store.Tags.PruneUsage(ctx, time.Now().Add(-retention-time.Hour))
+	if err != nil {
+		return err
+	}
+
+	if pruned > 0 {
+		app.logger.Infow("pruned tag usage buckets", "count", pruned)
+	}
+	return nil
+}
@@ -38,6 +38,30 @@ func writeJSONError(w http.ResponseWriter, status int, message string) error {
 	return writeJSON(w, status, envelope{Error: message})
 }
 
+// writeJSONErrorCode is writeJSONError with a machine readable code, for
+// errors clients are expected to tell apart.
+func writeJSONErrorCode(w http.ResponseWriter, status int, code, message string) error {
+
+	type envelope struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+
+	return writeJSON(w, status, envelope{Error: message, Code: code})
+}
+
+// writeJSONFieldErrors is writeJSONError with what is wrong with each
+// offending field.
+func writeJSONFieldErrors(w http.ResponseWriter, status int, message string, fields map[string]string) error {
+
+	type envelope struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+
+	return writeJSON(w, status, envelope{Error: message, Fields: fields})
+}
+
 func (app *application) jsonResponse(w http.ResponseWriter, status int, data any) error {
 	type envelope struct {
 		Data any `json:"data"`
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"crypto/hkdf"
+	"crypto/sha256"
 	"expvar"
+	"fmt"
 	"log"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Pedro-Foramilio/social/internal/auth"
+	"github.com/Pedro-Foramilio/social/internal/blob"
 	"github.com/Pedro-Foramilio/social/internal/db"
 	"github.com/Pedro-Foramilio/social/internal/env"
 	"github.com/Pedro-Foramilio/social/internal/mailer"
+	"github.com/Pedro-Foramilio/social/internal/presence"
+	"github.com/Pedro-Foramilio/social/internal/pubsub"
 	ratelimiter "github.com/Pedro-Foramilio/social/internal/rateLimiter"
 	"github.com/Pedro-Foramilio/social/internal/store"
 	"github.com/Pedro-Foramilio/social/internal/store/cache"
@@ -70,11 +79,85 @@ func main() {
 			TimeFrame:            time.Second * 5,
 			Enabled:              env.GetBool("RATE_LIMITER_ENABLED", true),
 		},
+		trash: trashConfig{
+			retention:     time.Hour * 24 * time.Duration(env.GetInt("TRASH_RETENTION_DAYS", 30)),
+			purgeInterval: time.Hour,
+		},
+		publisher: publisherConfig{
+			interval:  time.Second * time.Duration(env.GetInt("PUBLISHER_INTERVAL_SECONDS", 30)),
+			batchSize: 100,
+		},
+		reactions: reactionsConfig{
+			types: parseReactionTypes(env.GetString("REACTION_TYPES", "love,laugh,wow,sad,angry")),
+		},
+		attachments: attachmentsConfig{
+			dir:           env.GetString("ATTACHMENTS_DIR", "./data/attachments"),
+			thumbnailSize: 320,
+			maxBytes: map[string]int64{
+				"user":      int64(env.GetInt("ATTACHMENT_MAX_MB_USER", 5)) << 20,
+				"moderator": int64(env.GetInt("ATTACHMENT_MAX_MB_MODERATOR", 10)) << 20,
+				"admin":     int64(env.GetInt("ATTACHMENT_MAX_MB_ADMIN", 20)) << 20,
+			},
+			orphanTTL:  time.Hour * 24,
+			gcInterval: time.Hour,
+		},
+		comments: commentsConfig{
+			maxDepth:   env.GetInt("COMMENTS_MAX_DEPTH", 3),
+			editWindow: time.Minute * time.Duration(env.GetInt("COMMENTS_EDIT_WINDOW_MINUTES", 15)),
+		},
+		explore: exploreConfig{
+			cacheTTL: time.Second * time.Duration(env.GetInt("EXPLORE_CACHE_TTL_SECONDS", 30)),
+		},
+		feed: feedConfig{
+			cursorSecret:       env.GetString("FEED_CURSOR_SECRET", ""),
+			fanOutMaxFollowers: env.GetInt("FEED_FANOUT_MAX_FOLLOWERS", 10000),
+			ranking: store.FeedRanking{
+				Reactions: env.GetFloat("FEED_TOP_REACTIONS_WEIGHT", 1),
+				Comments:  env.GetFloat("FEED_TOP_COMMENTS_WEIGHT", 2),
+				Reposts:   env.GetFloat("FEED_TOP_REPOSTS_WEIGHT", 3),
+				Affinity:  env.GetFloat("FEED_TOP_AFFINITY_WEIGHT", 2),
+				Gravity:   env.GetFloat("FEED_TOP_GRAVITY", 1.5),
+				Window:    time.Hour * time.Duration(env.GetInt("FEED_TOP_WINDOW_HOURS", 72)),
+			},
+		},
+		events: eventsConfig{
+			heartbeat: time.Second * time.Duration(env.GetInt("EVENTS_HEARTBEAT_SECONDS", 15)),
+			buffer:    env.GetInt("EVENTS_BUFFER", 64),
+		},
+		ws: wsConfig{
+			maxTopics: env.GetInt("WS_MAX_TOPICS", 50),
+			rateLimiter: ratelimiter.Config{
+				RequestsPerTimeFrame: env.GetInt("WS_RATE_LIMITER_MESSAGES_COUNT", 20),
+				TimeFrame:            time.Second * 5,
+				Enabled:              env.GetBool("WS_RATE_LIMITER_ENABLED", true),
+			},
+		},
+		trending: trendingConfig{
+			defaultWindow: env.GetString("TRENDING_DEFAULT_WINDOW", "24h"),
+			pruneInterval: time.Hour,
+		},
 	}
 
 	logger := zap.Must(zap.NewProduction()).Sugar()
 	defer logger.Sync()
 
+	if cfg.feed.cursorSecret == "" {
+		// a key of its own, so that cursors are never signed with the JWT key
+		key, err := hkdf.Key(sha256.New, []byte(cfg.auth.token.secret), nil, "social feed cursors", sha256.Size)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.feed.cursorSecret = string(key)
+	}
+
+	cfg.trending.windows, err = parseTrendingWindows(env.GetString("TRENDING_WINDOWS", "1h,24h,7d"))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if _, ok := cfg.trending.windows[cfg.trending.defaultWindow]; !ok {
+		logger.Fatalf("TRENDING_DEFAULT_WINDOW %q is not one of TRENDING_WINDOWS", cfg.trending.defaultWindow)
+	}
+
 	db, err := db.New(
 		dbConfig.addr,
 		dbConfig.maxOpenConns,
@@ -113,6 +196,27 @@ func main() {
 
 	rateLimiter := ratelimiter.NewFixedWindowRateLimiter(cfg.rateLimiter.RequestsPerTimeFrame, cfg.rateLimiter.TimeFrame)
 
+	blobStorage, err := blob.NewLocalStorage(cfg.attachments.dir)
+	if err != nil {
+		logger.Fatalf("Error initializing attachment storage: %v\n", err)
+	}
+
+	// connections missing two heartbeats are considered gone
+	presenceTTL := 3 * cfg.events.heartbeat
+
+	var broker pubsub.Broker
+	var tracker presence.Tracker
+	if redisCfg.enabled {
+		broker = pubsub.NewRedisBroker(redis, cfg.events.buffer)
+		tracker = presence.NewRedisTracker(redis, presenceTTL)
+	} else {
+		broker = pubsub.NewMemoryBroker(cfg.events.buffer)
+		tracker = presence.NewMemoryTracker()
+	}
+	defer broker.Close()
+
+	wsLimiter := ratelimiter.NewFixedWindowRateLimiter(cfg.ws.rateLimiter.RequestsPerTimeFrame, cfg.ws.rateLimiter.TimeFrame)
+
 	app := &application{
 		config:        cfg,
 		store:         store,
@@ -121,6 +225,10 @@ func main() {
 		mailer:        mailer,
 		authenticator: jwtAuth,
 		rateLimiter:   rateLimiter,
+		blobStorage:   blobStorage,
+		broker:        broker,
+		presence:      tracker,
+		wsLimiter:     wsLimiter,
 	}
 
 	expvar.NewString("version").Set(version)
@@ -134,3 +242,49 @@ func main() {
 	mux := app.mount()
 	logger.Fatal(app.run(mux))
 }
+
+// parseReactionTypes splits a comma separated list of reaction types.
+// "like" is always accepted.
+func parseReactionTypes(value string) []string {
+	types := []string{"like"}
+	for _, t := range strings.Split(value, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" && !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// parseTrendingWindows parses a comma separated list of durations such as
+// "1h,24h,7d", keyed by their spelling. Days ("d") are accepted on top of
+// the units of time.ParseDuration.
+func parseTrendingWindows(value string) (map[string]time.Duration, error) {
+	windows := make(map[string]time.Duration)
+	for _, w := range strings.Split(value, ",") {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+
+		var d time.Duration
+		var err error
+		if days, ok := strings.CutSuffix(w, "d"); ok {
+			var n int
+			n, err = strconv.Atoi(days)
+			d = time.Duration(n) * 24 * time.Hour
+		} else {
+			d, err = time.ParseDuration(w)
+		}
+
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid trending window %q", w)
+		}
+		windows[w] = d
+	}
+
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("no trending windows configured")
+	}
+	return windows, nil
+}
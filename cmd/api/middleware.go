@@ -88,6 +88,22 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// OptionalAuthTokenMiddleware authenticates the request like
+// AuthTokenMiddleware when it carries an Authorization header and lets it
+// through anonymously otherwise.
+func (app *application) OptionalAuthTokenMiddleware(next http.Handler) http.Handler {
+	authenticated := app.AuthTokenMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) checkPostOwnership(role string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -114,6 +130,39 @@ func (app *application) checkPostOwnership(role string, next http.HandlerFunc) h
 	})
 }
 
+// checkCommentOwnership lets the author of a comment through, and anyone else
+// whose role is at least role. Tombstones cannot be modified.
+func (app *application) checkCommentOwnership(role string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		user := getUserFromContext(r)
+		comment := getCommentFromCtx(r)
+
+		if comment.Deleted {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, role)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenErrorResponse(w, r, fmt.Errorf("insufficient permissions to modify this resource"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) checkRolePrecedence(context context.Context, user *store.User, roleName string) (bool, error) {
 	role, err := app.store.Roles.GetByName(context, roleName)
 	if err != nil {
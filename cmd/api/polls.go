@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+)
+
+type CreatePollPayload struct {
+	Options        []string  `json:"options" validate:"min=2,max=6,unique,dive,required,max=100"`
+	MultipleChoice bool      `json:"multiple_choice"`
+	ClosesAt       time.Time `json:"closes_at" validate:"required"`
+}
+
+type VotePollPayload struct {
+	OptionIDs []int64 `json:"option_ids" validate:"min=1,max=6,unique"`
+}
+
+// newPoll builds the poll of a new post. Polls of scheduled posts must stay
+// open after the post is published.
+func newPoll(payload *CreatePollPayload, publishAt *time.Time) (*store.Poll, error) {
+	opensAt := time.Now()
+	if publishAt != nil {
+		opensAt = *publishAt
+	}
+
+	if !payload.ClosesAt.After(opensAt) {
+		return nil, fmt.Errorf("poll closes_at must be after the post is published")
+	}
+
+	poll := &store.Poll{
+		MultipleChoice: payload.MultipleChoice,
+		ClosesAt:       payload.ClosesAt.UTC().Format(time.RFC3339),
+	}
+
+	for _, text := range payload.Options {
+		poll.Options = append(poll.Options, store.PollOption{Text: text})
+	}
+
+	return poll, nil
+}
+
+func (app *application) votePollHandler(w http.ResponseWriter, r *http.Request) {
+	var payload VotePollPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	post := getPostsFromCtx(r)
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	if err := app.store.Polls.Vote(ctx, post.ID, user.ID, payload.OptionIDs); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrInvalidVote):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrAlredyExists):
+			app.conflictResponse(w, r, fmt.Errorf("already voted in this poll"))
+		case errors.Is(err, store.ErrPollClosed):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Posts.Hydrate(ctx, user.ID, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, post.Poll); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/Pedro-Foramilio/social/internal/store"
 	"github.com/go-chi/chi/v5"
@@ -15,15 +17,36 @@ type postKey string
 const postCtx postKey = "post"
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=255"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title         string             `json:"title" validate:"required,max=255"`
+	Content       string             `json:"content" validate:"required,max=1000"`
+	ContentFormat string             `json:"content_format" validate:"omitempty,oneof=plain markdown"`
+	Tags          []string           `json:"tags" validate:"max=20,dive,max=100"`
+	Status        string             `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt     *time.Time         `json:"publish_at" validate:"required_if=Status scheduled"`
+	AttachmentIDs []int64            `json:"attachment_ids" validate:"max=4,unique"`
+	Visibility    string             `json:"visibility" validate:"omitempty,oneof=public followers mentioned private"`
+	CommentPolicy string             `json:"comment_policy" validate:"omitempty,oneof=open followers mentioned locked"`
+	Language      string             `json:"language" validate:"omitempty,oneof=simple danish dutch english finnish french german hungarian italian norwegian portuguese romanian russian spanish swedish turkish"`
+	Poll          *CreatePollPayload `json:"poll"`
+}
+
+// PostResponse is a post with the cursor to the rest of its top-level
+// comments, when they were included and there are more.
+type PostResponse struct {
+	*store.Post
+	CommentsNextCursor string `json:"comments_next_cursor,omitempty"`
 }
 
 type UpdatePostPayload struct {
-	Title   *string   `json:"title" validate:"omitempty,max=255"`
-	Content *string   `json:"content" validate:"omitempty,max=1000"`
-	Tags    *[]string `json:"tags" validate:"omitempty"`
+	Title         *string    `json:"title" validate:"omitempty,max=255"`
+	Content       *string    `json:"content" validate:"omitempty,max=1000"`
+	ContentFormat *string    `json:"content_format" validate:"omitempty,oneof=plain markdown"`
+	Tags          *[]string  `json:"tags" validate:"omitempty,max=20,dive,max=100"`
+	Status        *string    `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt     *time.Time `json:"publish_at"`
+	Visibility    *string    `json:"visibility" validate:"omitempty,oneof=public followers mentioned private"`
+	CommentPolicy *string    `json:"comment_policy" validate:"omitempty,oneof=open followers mentioned locked"`
+	Language      *string    `json:"language" validate:"omitempty,oneof=simple danish dutch english finnish french german hungarian italian norwegian portuguese romanian russian spanish swedish turkish"`
 }
 
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -43,20 +66,59 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 	user := getUserFromContext(r)
 
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  user.ID,
+		Title:         payload.Title,
+		Content:       payload.Content,
+		ContentFormat: payload.ContentFormat,
+		Tags:          payload.Tags,
+		UserID:        user.ID,
+		Visibility:    payload.Visibility,
+		CommentPolicy: payload.CommentPolicy,
+		Language:      payload.Language,
+	}
+
+	for _, id := range payload.AttachmentIDs {
+		post.Attachments = append(post.Attachments, store.Attachment{ID: id})
+	}
+
+	status := payload.Status
+	if status == "" {
+		status = store.PostStatusPublished
+	}
+
+	if err := setPostStatus(post, status, payload.PublishAt); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.Poll != nil {
+		poll, err := newPoll(payload.Poll, payload.PublishAt)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		post.Poll = poll
 	}
 
 	ctx := r.Context()
 
 	if err := app.store.Posts.Create(ctx, post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("unknown or already used attachment_ids"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.publishToTimelines(ctx, post, true)
+
+	if err := app.store.Posts.Hydrate(ctx, user.ID, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
+	if err := app.postResponse(w, r, http.StatusCreated, post.Version, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -66,15 +128,55 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostsFromCtx(r)
 	ctx := r.Context()
 
-	comments, err := app.store.Comments.GetByPostId(ctx, post.ID)
+	var commentsNextCursor string
+	if r.URL.Query().Get("include") == "comments" {
+		limit := 20
+		if l := r.URL.Query().Get("comments_limit"); l != "" {
+			var err error
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > 100 {
+				app.badRequestResponse(w, r, fmt.Errorf("comments_limit must be between 1 and 100"))
+				return
+			}
+		}
+
+		page, err := app.getCommentsPage(ctx, store.CommentQuery{
+			PostID: post.ID,
+			Sort:   store.CommentSortOldest,
+			Limit:  limit,
+		})
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		post.Comments = page.Comments
+		commentsNextCursor = page.NextCursor
+	}
+
+	user := getUserFromContext(r)
+	reaction, err := app.store.Reactions.GetPostReaction(ctx, post.ID, user.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	post.Comments = comments
+	if reaction != "" {
+		post.MyReaction = &reaction
+	}
+
+	post.Bookmarked, err = app.store.Bookmarks.IsBookmarked(ctx, user.ID, post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Posts.Hydrate(ctx, user.ID, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+	if err := app.postResponse(w, r, http.StatusOK, post.Version, PostResponse{Post: post, CommentsNextCursor: commentsNextCursor}); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -82,33 +184,53 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
-	postIDStr := chi.URLParam(r, "postID")
-	postID, err := strconv.ParseInt(postIDStr, 10, 64)
-	if err != nil {
-		app.internalServerError(w, r, err)
+	post := getPostsFromCtx(r)
+
+	if !checkIfMatch(r, post.Version) {
+		app.preconditionFailedResponse(w, r, fmt.Errorf("post version %d does not match If-Match", post.Version))
 		return
 	}
 
+	user := getUserFromContext(r)
 	ctx := r.Context()
 
-	err = app.store.Posts.Delete(ctx, postID)
+	// with If-Match, the delete only applies to the version checked above
+	var version int
+	if r.Header.Get("If-Match") != "" {
+		version = post.Version
+	}
+
+	err := app.store.Posts.Delete(ctx, post.ID, user.ID, version)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 			return
+		case errors.Is(err, store.ErrConflict):
+			app.preconditionFailedResponse(w, r, fmt.Errorf("post was modified since version %d", post.Version))
+			return
 		default:
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
 
+	app.removeFromTimelines(ctx, post)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostsFromCtx(r)
 
+	if !checkIfMatch(r, post.Version) {
+		app.preconditionFailedResponse(w, r, fmt.Errorf("post version %d does not match If-Match", post.Version))
+		return
+	}
+
+	wasPublished := post.Status == store.PostStatusPublished
+	wasPrivate := post.Visibility == store.VisibilityPrivate
+
 	var payload UpdatePostPayload
 	if err := readJSON(w, r, &payload); err != nil {
 		app.badRequestResponse(w, r, err)
@@ -126,21 +248,213 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	if payload.Content != nil {
 		post.Content = *payload.Content
 	}
+	if payload.ContentFormat != nil {
+		post.ContentFormat = *payload.ContentFormat
+	}
 	if payload.Tags != nil {
 		post.Tags = *payload.Tags
 	}
+	if payload.Visibility != nil {
+		post.Visibility = *payload.Visibility
+	}
+	if payload.CommentPolicy != nil {
+		post.CommentPolicy = *payload.CommentPolicy
+	}
+	if payload.Language != nil {
+		post.Language = *payload.Language
+	}
+	if payload.Status != nil || payload.PublishAt != nil {
+		status := post.Status
+		if payload.Status != nil {
+			status = *payload.Status
+		}
+
+		if err := setPostStatus(post, status, payload.PublishAt); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
 
 	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict) && r.Header.Get("If-Match") != "":
+			// the version checked above changed before the update
+			app.preconditionFailedResponse(w, r, fmt.Errorf("post was modified since version %d", post.Version))
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	switch published := post.Status == store.PostStatusPublished; {
+	case published && !wasPublished:
+		app.publishToTimelines(r.Context(), post, true)
+	case !published && wasPublished:
+		app.removeFromTimelines(r.Context(), post)
+	case published && wasPrivate && post.Visibility != store.VisibilityPrivate:
+		// private posts were only fanned out to their author
+		app.invalidateCachedPost(r.Context(), post.ID)
+		app.publishToTimelines(r.Context(), post, false)
+	default:
+		app.invalidateCachedPost(r.Context(), post.ID)
+	}
+
+	if err := app.postResponse(w, r, http.StatusOK, post.Version, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listPostsByStatus(w, r, store.PostStatusDraft)
+}
+
+func (app *application) getScheduledHandler(w http.ResponseWriter, r *http.Request) {
+	app.listPostsByStatus(w, r, store.PostStatusScheduled)
+}
+
+func (app *application) listPostsByStatus(w http.ResponseWriter, r *http.Request, status string) {
+	user := getUserFromContext(r)
+
+	posts, err := app.store.Posts.GetByStatus(r.Context(), user.ID, status)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// setPostStatus applies a status transition to post. Published posts cannot
+// go back to draft or scheduled, and scheduled posts need a future publish_at.
+func setPostStatus(post *store.Post, status string, publishAt *time.Time) error {
+	if post.Status == store.PostStatusPublished && status != store.PostStatusPublished {
+		return fmt.Errorf("published posts cannot be moved back to %s", status)
+	}
+
+	switch status {
+	case store.PostStatusScheduled:
+		if publishAt == nil {
+			if post.PublishAt == nil {
+				return fmt.Errorf("publish_at is required for scheduled posts")
+			}
+		} else {
+			if !publishAt.After(time.Now()) {
+				return fmt.Errorf("publish_at must be in the future")
+			}
+			at := publishAt.UTC().Format(time.RFC3339)
+			post.PublishAt = &at
+		}
+	default:
+		if publishAt != nil {
+			return fmt.Errorf("publish_at is only allowed for scheduled posts")
+		}
+		post.PublishAt = nil
+	}
+
+	post.Status = status
+	return nil
+}
+
+func (app *application) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	deletedSince := time.Now().Add(-app.config.trash.retention)
+
+	posts, err := app.store.Posts.GetTrash(r.Context(), user.ID, deletedSince)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	deletedSince := time.Now().Add(-app.config.trash.retention)
+
+	if err := app.store.Posts.Restore(ctx, postID, user.ID, deletedSince); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrAlredyExists):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	post, err := app.store.Posts.GetByID(ctx, postID)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+	app.publishToTimelines(ctx, post, false)
+
+	if err := app.postResponse(w, r, http.StatusOK, post.Version, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
+func (app *application) pinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostsFromCtx(r)
+	user := getUserFromContext(r)
+
+	if post.UserID != user.ID {
+		app.forbiddenErrorResponse(w, r, fmt.Errorf("only the author can pin a post"))
+		return
+	}
+
+	if err := app.store.Posts.Pin(r.Context(), post.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrPinLimit):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unpinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostsFromCtx(r)
+	user := getUserFromContext(r)
+
+	if post.UserID != user.ID {
+		app.forbiddenErrorResponse(w, r, fmt.Errorf("only the author can unpin a post"))
+		return
+	}
+
+	if err := app.store.Posts.Unpin(r.Context(), post.ID, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		postIDStr := chi.URLParam(r, "postID")
@@ -166,6 +480,26 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Posts the viewer may not see are reported as missing rather than
+		// forbidden, so their existence is not disclosed.
+		user := getUserFromContext(r)
+		if user == nil || user.ID != post.UserID {
+			if post.Status != store.PostStatusPublished || user == nil {
+				app.notFoundResponse(w, r, store.ErrNotFound)
+				return
+			}
+
+			visible, err := app.store.Posts.CanView(ctx, post.ID, user.ID)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !visible {
+				app.notFoundResponse(w, r, store.ErrNotFound)
+				return
+			}
+		}
+
 		ctx = context.WithValue(ctx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type SetReactionPayload struct {
+	Type string `json:"type" validate:"required,max=32"`
+}
+
+func (app *application) setPostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	reaction, ok := app.readReaction(w, r)
+	if !ok {
+		return
+	}
+
+	post := getPostsFromCtx(r)
+	user := getUserFromContext(r)
+
+	changed, err := app.store.Reactions.SetPostReaction(r.Context(), post.ID, user.ID, reaction)
+	if err != nil {
+		app.reactionErrorResponse(w, r, err)
+		return
+	}
+
+	// repeating the same reaction is a no-op and notifies nobody
+	if changed {
+		app.notify(r.Context(), post.UserID, user, Notification{Kind: NotificationReaction, PostID: post.ID, Reaction: reaction})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) removePostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostsFromCtx(r)
+	user := getUserFromContext(r)
+
+	if err := app.store.Reactions.RemovePostReaction(r.Context(), post.ID, user.ID); err != nil {
+		app.reactionErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) setCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	reaction, ok := app.readReaction(w, r)
+	if !ok {
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if _, err := app.store.Reactions.SetCommentReaction(r.Context(), commentID, user.ID, reaction); err != nil {
+		app.reactionErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) removeCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Reactions.RemoveCommentReaction(r.Context(), commentID, user.ID); err != nil {
+		app.reactionErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readReaction decodes and validates a SetReactionPayload, writing the error
+// response itself when the payload is rejected.
+func (app *application) readReaction(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var payload SetReactionPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return "", false
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return "", false
+	}
+
+	if !slices.Contains(app.config.reactions.types, payload.Type) {
+		app.badRequestResponse(w, r, fmt.Errorf("unsupported reaction type %q", payload.Type))
+		return "", false
+	}
+
+	return payload.Type, true
+}
+
+func (app *application) reactionErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFoundResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
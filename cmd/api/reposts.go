@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+)
+
+type RepostPayload struct {
+	Content       string   `json:"content" validate:"max=1000"`
+	ContentFormat string   `json:"content_format" validate:"omitempty,oneof=plain markdown"`
+	Tags          []string `json:"tags" validate:"max=20,dive,max=100"`
+}
+
+// repostHandler shares a post with the user's followers. Without content it
+// creates a plain repost; with content it creates a quote post.
+func (app *application) repostHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RepostPayload
+
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	original, err := app.repostTarget(ctx, getPostsFromCtx(r))
+	if err == nil && original.Status != store.PostStatusPublished {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	// Resharing is limited to public posts, which would otherwise leak to
+	// the reposter's followers through the embedded original.
+	if original.Visibility != store.VisibilityPublic {
+		app.forbiddenErrorResponse(w, r, fmt.Errorf("only public posts can be reposted"))
+		return
+	}
+
+	post := &store.Post{
+		UserID:        user.ID,
+		Content:       payload.Content,
+		ContentFormat: payload.ContentFormat,
+		Tags:          payload.Tags,
+		RepostOfID:    &original.ID,
+		IsQuote:       payload.Content != "",
+	}
+
+	if err := app.store.Posts.Create(ctx, post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrAlredyExists):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.publishToTimelines(ctx, post, true)
+	// the cached original carries the repost count
+	app.invalidateCachedPost(ctx, original.ID)
+
+	if err := app.store.Posts.Hydrate(ctx, user.ID, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteRepostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostsFromCtx(r)
+	originalID := post.ID
+	if post.IsPlainRepost() {
+		originalID = *post.RepostOfID
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	repost, err := app.store.Posts.DeleteRepost(ctx, user.ID, originalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.removeFromTimelines(ctx, repost)
+	app.invalidateCachedPost(ctx, originalID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// repostTarget resolves plain reposts to the post they share, so reposting a
+// repost references the original instead of building a chain.
+func (app *application) repostTarget(ctx context.Context, post *store.Post) (*store.Post, error) {
+	if post.IsPlainRepost() {
+		return app.store.Posts.GetByID(ctx, *post.RepostOfID)
+	}
+	return post, nil
+}
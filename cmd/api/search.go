@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+)
+
+type SearchResponse struct {
+	Posts    []store.PostSearchResult    `json:"posts"`
+	Comments []store.CommentSearchResult `json:"comments"`
+	Users    []store.UserSearchResult    `json:"users"`
+}
+
+// searchHandler runs a full text search across posts, comments and users,
+// or the ones listed in type. Anonymous requests only find public posts and
+// their comments.
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	sq := store.SearchQuery{
+		Query:    strings.TrimSpace(qs.Get("q")),
+		Types:    []string{store.SearchPosts, store.SearchComments, store.SearchUsers},
+		Language: store.DefaultLanguage,
+		Limit:    10,
+	}
+
+	if types := qs.Get("type"); types != "" {
+		sq.Types = strings.Split(types, ",")
+	}
+
+	if lang := qs.Get("lang"); lang != "" {
+		sq.Language = lang
+	}
+
+	for name, dest := range map[string]*int{"limit": &sq.Limit, "offset": &sq.Offset} {
+		value := qs.Get(name)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		*dest = n
+	}
+
+	if err := Validate.Struct(sq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var viewerID int64
+	if user := getUserFromContext(r); user != nil {
+		viewerID = user.ID
+	}
+
+	ctx := r.Context()
+
+	var res SearchResponse
+	var err error
+
+	if slices.Contains(sq.Types, store.SearchPosts) {
+		if res.Posts, err = app.store.Search.Posts(ctx, viewerID, sq); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if slices.Contains(sq.Types, store.SearchComments) {
+		if res.Comments, err = app.store.Search.Comments(ctx, viewerID, sq); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if slices.Contains(sq.Types, store.SearchUsers) {
+		if res.Users, err = app.store.Search.Users(ctx, sq); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+)
+
+// Syndication feeds let feed readers follow a user's or a tag's public
+// posts, in RSS 2.0, Atom or JSON Feed 1.1. They are public, so they never
+// include private, followers-only or mentioned-only posts.
+
+const (
+	feedFormatRSS  = "rss"
+	feedFormatAtom = "atom"
+	feedFormatJSON = "json"
+)
+
+// syndicationFeedSize is the number of latest posts listed in a feed.
+const syndicationFeedSize = 20
+
+// syndicationFeed is a feed before it is rendered in a format.
+type syndicationFeed struct {
+	title       string
+	description string
+	// link is the page the feed is about, and self the URL of the feed.
+	link  string
+	self  string
+	posts []store.PostWithMetadata
+	// updated is the time of the latest change to the feed, including
+	// posts that left it.
+	updated time.Time
+}
+
+func (app *application) getUserSyndicationHandler(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getProfileUserFromCtx(r)
+		if !user.IsActive {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
+		// read first, so that a change landing in between shows up next time
+		updated, err := app.store.Posts.GetPublicPostsChangedAt(r.Context(), user.ID, "")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		posts, err := app.store.Posts.GetPublicPosts(r.Context(), user.ID, "", syndicationFeedSize)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.writeSyndicationFeed(w, r, format, syndicationFeed{
+			title:       user.Username,
+			description: fmt.Sprintf("Public posts by %s", user.Username),
+			link:        app.userURL(user),
+			self:        requestURL(r),
+			posts:       posts,
+			updated:     updated,
+		})
+	}
+}
+
+func (app *application) getTagSyndicationHandler(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag, err := tagParam(r)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		updated, err := app.store.Posts.GetPublicPostsChangedAt(r.Context(), 0, tag)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		posts, err := app.store.Posts.GetPublicPosts(r.Context(), 0, tag, syndicationFeedSize)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.writeSyndicationFeed(w, r, format, syndicationFeed{
+			title:       "#" + tag,
+			description: fmt.Sprintf("Public posts tagged #%s", tag),
+			link:        fmt.Sprintf("%s/tags/%s", app.config.frontendURL, tag),
+			self:        requestURL(r),
+			posts:       posts,
+			updated:     updated,
+		})
+	}
+}
+
+// writeSyndicationFeed renders feed in format, answering 304 when the client
+// already holds it according to If-None-Match or If-Modified-Since.
+func (app *application) writeSyndicationFeed(w http.ResponseWriter, r *http.Request, format string, feed syndicationFeed) {
+	var body []byte
+	var contentType string
+	var err error
+
+	switch format {
+	case feedFormatRSS:
+		body, err = app.renderRSS(feed)
+		contentType = "application/rss+xml; charset=utf-8"
+	case feedFormatAtom:
+		body, err = app.renderAtom(feed)
+		contentType = "application/atom+xml; charset=utf-8"
+	default:
+		body, err = app.renderJSONFeed(feed)
+		contentType = "application/feed+json; charset=utf-8"
+	}
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	if !feed.updated.IsZero() {
+		w.Header().Set("Last-Modified", feed.updated.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, feed.updated) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// notModified reports whether the conditional headers of r match the
+// current feed. If-None-Match takes precedence over If-Modified-Since.
+func notModified(r *http.Request, etag string, updated time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(header, etag, true)
+	}
+
+	header := r.Header.Get("If-Modified-Since")
+	if header == "" || updated.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+
+	return !updated.Truncate(time.Second).After(since)
+}
+
+// requestURL returns the absolute URL of r, as seen by the client.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+func (app *application) postURL(post *store.Post) string {
+	return fmt.Sprintf("%s/posts/%d", app.config.frontendURL, post.ID)
+}
+
+func (app *application) userURL(user *store.User) string {
+	return fmt.Sprintf("%s/users/%d", app.config.frontendURL, user.ID)
+}
+
+func postTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return t
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	LastBuildDate string      `xml:"lastBuildDate,omitempty"`
+	Self          rssAtomLink `xml:"atom:link"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Creator     string   `xml:"dc:creator"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// renderRSS renders feed as RSS 2.0. The HTML of the posts is escaped by the
+// encoder, as RSS descriptions expect.
+func (app *application) renderRSS(feed syndicationFeed) ([]byte, error) {
+	channel := rssChannel{
+		Title:       feed.title,
+		Link:        feed.link,
+		Description: feed.description,
+		Self:        rssAtomLink{Href: feed.self, Rel: "self", Type: "application/rss+xml"},
+		Items:       make([]rssItem, len(feed.posts)),
+	}
+
+	if !feed.updated.IsZero() {
+		channel.LastBuildDate = feed.updated.UTC().Format(time.RFC1123Z)
+	}
+
+	for i, p := range feed.posts {
+		link := app.postURL(&p.Post)
+		channel.Items[i] = rssItem{
+			Title:       p.Title,
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			PubDate:     postTime(p.CreatedAt).UTC().Format(time.RFC1123Z),
+			Creator:     p.User.Username,
+			Categories:  p.Tags,
+			Description: p.ContentHTML,
+		}
+	}
+
+	return marshalXML(rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: channel,
+	})
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Author     atomPerson     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (app *application) renderAtom(feed syndicationFeed) ([]byte, error) {
+	updated := feed.updated
+	if updated.IsZero() {
+		// atom requires an updated date even for empty feeds
+		updated = time.Unix(0, 0)
+	}
+
+	out := atomFeed{
+		ID:       feed.link,
+		Title:    feed.title,
+		Subtitle: feed.description,
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: feed.link, Rel: "alternate", Type: "text/html"},
+			{Href: feed.self, Rel: "self", Type: "application/atom+xml"},
+		},
+		Entries: make([]atomEntry, len(feed.posts)),
+	}
+
+	for i, p := range feed.posts {
+		link := app.postURL(&p.Post)
+
+		categories := make([]atomCategory, len(p.Tags))
+		for j, tag := range p.Tags {
+			categories[j] = atomCategory{Term: tag}
+		}
+
+		out.Entries[i] = atomEntry{
+			ID:         link,
+			Title:      p.Title,
+			Published:  postTime(p.CreatedAt).UTC().Format(time.RFC3339),
+			Updated:    postTime(p.UpdatedAt).UTC().Format(time.RFC3339),
+			Link:       atomLink{Href: link, Rel: "alternate", Type: "text/html"},
+			Author:     atomPerson{Name: p.User.Username, URI: app.userURL(&p.User)},
+			Categories: categories,
+			Content:    atomContent{Type: "html", Value: p.ContentHTML},
+		}
+	}
+
+	return marshalXML(out)
+}
+
+func marshalXML(v any) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Tags          []string         `json:"tags,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// renderJSONFeed renders feed as JSON Feed 1.1 (https://jsonfeed.org).
+func (app *application) renderJSONFeed(feed syndicationFeed) ([]byte, error) {
+	out := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.title,
+		Description: feed.description,
+		HomePageURL: feed.link,
+		FeedURL:     feed.self,
+		Items:       make([]jsonFeedItem, len(feed.posts)),
+	}
+
+	for i, p := range feed.posts {
+		out.Items[i] = jsonFeedItem{
+			ID:            strconv.FormatInt(p.ID, 10),
+			URL:           app.postURL(&p.Post),
+			Title:         p.Title,
+			ContentHTML:   p.ContentHTML,
+			DatePublished: postTime(p.CreatedAt).UTC().Format(time.RFC3339),
+			DateModified:  postTime(p.UpdatedAt).UTC().Format(time.RFC3339),
+			Tags:          p.Tags,
+			Authors:       []jsonFeedAuthor{{Name: p.User.Username, URL: app.userURL(&p.User)}},
+		}
+	}
+
+	return json.MarshalIndent(out, "", "  ")
+}
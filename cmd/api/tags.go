@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/markup"
+	"github.com/Pedro-Foramilio/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type TrendingTagsResponse struct {
+	Window string              `json:"window"`
+	Tags   []store.TrendingTag `json:"tags"`
+}
+
+type PostsPage struct {
+	Posts      []store.PostWithMetadata `json:"posts"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+	PrevCursor string                   `json:"prev_cursor,omitempty"`
+}
+
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	window := qs.Get("window")
+	if window == "" {
+		window = app.config.trending.defaultWindow
+	}
+
+	duration, ok := app.config.trending.windows[window]
+	if !ok {
+		windows := make([]string, 0, len(app.config.trending.windows))
+		for w := range app.config.trending.windows {
+			windows = append(windows, w)
+		}
+		slices.Sort(windows)
+		app.badRequestResponse(w, r, fmt.Errorf("window must be one of %s", strings.Join(windows, ", ")))
+		return
+	}
+
+	limit := 10
+	if l := qs.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > 50 {
+			app.badRequestResponse(w, r, fmt.Errorf("limit must be between 1 and 50"))
+			return
+		}
+	}
+
+	tags, err := app.store.Tags.GetTrending(r.Context(), time.Now().Add(-duration), limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, TrendingTagsResponse{Window: window, Tags: tags}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// tagParam returns the normalized {tag} URL parameter.
+func tagParam(r *http.Request) (string, error) {
+	tag, err := url.PathUnescape(chi.URLParam(r, "tag"))
+	if err != nil {
+		return "", err
+	}
+
+	tag = markup.NormalizeTag(tag)
+	if tag == "" {
+		return "", fmt.Errorf("tag is required")
+	}
+
+	return tag, nil
+}
+
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := tagParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err = fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if fq.Cursor != "" {
+		fq.Position, err = app.parseFeedCursor(fq.Cursor)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	limit := fq.Limit
+	// fetch one extra row to know whether there is a next page
+	fq.Limit++
+
+	user := getUserFromContext(r)
+
+	posts, err := app.store.Posts.GetByTag(r.Context(), user.ID, tag, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	page := PostsPage{Posts: posts}
+	if len(posts) > limit {
+		page.Posts = posts[:limit]
+		page.NextCursor = app.signFeedCursor(store.FeedCursor{Cursor: store.CursorFor(&page.Posts[limit-1].Post)})
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
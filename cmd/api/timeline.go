@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+	"github.com/Pedro-Foramilio/social/internal/store/cache"
+)
+
+// Feeds are materialized in Redis when the cache is enabled: new posts are
+// pushed into the timelines of the author and their followers, and the
+// first pages of the feed are read from there. Authors with more than
+// feed.fanOutMaxFollowers followers are not fanned out; their followers are
+// served by the SQL feed instead.
+
+func timelineEntry(post *store.Post) store.TimelineEntry {
+	return store.TimelineEntry{
+		PostID:    post.ID,
+		AuthorID:  post.UserID,
+		CreatedAt: store.CursorFor(post).CreatedAt,
+	}
+}
+
+// timelineAudience returns the users whose timelines may show posts of
+// authorID, or only the author when they have too many followers.
+func (app *application) timelineAudience(ctx context.Context, authorID int64) ([]int64, error) {
+	limit := app.config.feed.fanOutMaxFollowers
+
+	followers, err := app.store.Followers.GetFollowerIDs(ctx, authorID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(followers) > limit {
+		return []int64{authorID}, nil
+	}
+
+	return append(followers, authorID), nil
+}
+
+// publishToTimelines pushes a published post into the timelines of its
+// audience. fresh tells posts that just went live from older ones coming
+// back, like restored posts; only the former are streamed, in the
+// background, to the live events of the author and all their followers.
+// Failures are logged: readers fall back to SQL for whatever the timelines
+// miss.
+func (app *application) publishToTimelines(ctx context.Context, post *store.Post, fresh bool) {
+	if post.Status != store.PostStatusPublished || (!fresh && !app.config.redisCfg.enabled) {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	if fresh {
+		app.background.Add(1)
+		go func() {
+			defer app.background.Done()
+			app.streamPost(ctx, post.ID)
+		}()
+	}
+
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	audience := []int64{post.UserID}
+	if post.Visibility != store.VisibilityPrivate {
+		var err error
+		audience, err = app.timelineAudience(ctx, post.UserID)
+		if err != nil {
+			app.logger.Errorw("error fanning out post", "post", post.ID, "error", err)
+			return
+		}
+	}
+
+	if err := app.cacheStorage.Timelines.Add(ctx, audience, timelineEntry(post), fresh); err != nil {
+		app.logger.Errorw("error fanning out post", "post", post.ID, "error", err)
+	}
+}
+
+// removeFromTimelines takes a post out of the timelines and the post cache,
+// after it was deleted or unpublished.
+func (app *application) removeFromTimelines(ctx context.Context, post *store.Post) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	if err := app.cacheStorage.Posts.Delete(ctx, post.ID); err != nil {
+		app.logger.Errorw("error removing post from cache", "post", post.ID, "error", err)
+	}
+
+	audience, err := app.timelineAudience(ctx, post.UserID)
+	if err == nil {
+		err = app.cacheStorage.Timelines.Remove(ctx, audience, timelineEntry(post))
+	}
+	if err != nil {
+		app.logger.Errorw("error removing post from timelines", "post", post.ID, "error", err)
+	}
+}
+
+// invalidateCachedPost drops a post from the post cache after it changed.
+func (app *application) invalidateCachedPost(ctx context.Context, postID int64) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	if err := app.cacheStorage.Posts.Delete(context.WithoutCancel(ctx), postID); err != nil {
+		app.logger.Errorw("error removing post from cache", "post", postID, "error", err)
+	}
+}
+
+// canMaterializeFeed reports whether the feed page asked for by fq can be
+// read from the timelines, which only hold the unfiltered feed, newest first.
+func canMaterializeFeed(fq store.PaginatedFeedQuery) bool {
+	return fq.Sort == "desc" && fq.Offset == 0 &&
+		len(fq.Tags) == 0 && fq.Search == "" && fq.Since == "" && fq.Until == "" &&
+		(fq.Position == nil || (!fq.Position.Prev && fq.Position.Rank == nil))
+}
+
+// getMaterializedFeed returns the feed page asked for by fq from the user's
+// timeline, rebuilding it if needed, and continues in SQL when the timeline
+// runs out. ok is false when the user has to be served by the SQL feed.
+func (app *application) getMaterializedFeed(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) (posts []store.PostWithMetadata, ok bool, err error) {
+	popular, err := app.store.Followers.FollowsPopular(ctx, userID, app.config.feed.fanOutMaxFollowers)
+	if err != nil || popular {
+		return nil, false, err
+	}
+
+	exists, err := app.cacheStorage.Timelines.Exists(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !exists {
+		entries, err := app.store.Posts.GetFeedEntries(ctx, userID, cache.TimelineSize)
+		if err != nil || len(entries) == 0 {
+			return nil, false, err
+		}
+
+		if err := app.cacheStorage.Timelines.Fill(ctx, userID, entries); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var after *store.Cursor
+	if fq.Position != nil {
+		after = &fq.Position.Cursor
+	}
+
+	entries, err := app.cacheStorage.Timelines.Page(ctx, userID, after, fq.Limit)
+	if err != nil {
+		return nil, false, err
+	}
+
+	posts, err = app.loadTimelinePosts(ctx, userID, entries)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// the timeline ran out, or some of its entries are gone: continue with
+	// the SQL feed after its last entry. De-duplication against the page may
+	// drop tail posts, so read on until the page is full or SQL runs out.
+	tail := fq
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		tail.Position = &store.FeedCursor{Cursor: store.Cursor{CreatedAt: last.CreatedAt, ID: last.PostID}}
+	}
+
+	for len(posts) < fq.Limit {
+		tail.Limit = fq.Limit - len(posts)
+
+		more, err := app.store.Posts.GetUserFeed(ctx, userID, tail)
+		if err != nil {
+			return nil, false, err
+		}
+
+		posts = dedupFeed(append(posts, more...))
+
+		if len(more) < tail.Limit {
+			break
+		}
+		tail.Position = &store.FeedCursor{Cursor: store.CursorFor(&more[len(more)-1].Post)}
+	}
+
+	return posts, true, nil
+}
+
+// loadTimelinePosts reads the posts of entries through the post cache and
+// completes them for the viewer, keeping the order of entries.
+func (app *application) loadTimelinePosts(ctx context.Context, viewerID int64, entries []store.TimelineEntry) ([]store.PostWithMetadata, error) {
+	ids := make([]int64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.PostID
+	}
+
+	cached, err := app.cacheStorage.Posts.Get(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []int64
+	for _, id := range ids {
+		if _, ok := cached[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		loaded, err := app.store.Posts.GetByIDs(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := app.cacheStorage.Posts.Set(ctx, loaded); err != nil {
+			app.logger.Errorw("error caching posts", "error", err)
+		}
+
+		for _, p := range loaded {
+			cached[p.ID] = p
+		}
+	}
+
+	posts := make([]store.PostWithMetadata, 0, len(entries))
+	for _, id := range ids {
+		if p, ok := cached[id]; ok {
+			posts = append(posts, p)
+		}
+	}
+
+	posts, err = app.store.Posts.HydrateFeed(ctx, viewerID, posts)
+	if err != nil {
+		return nil, err
+	}
+
+	return dedupFeed(posts), nil
+}
+
+// dedupFeed applies the repost rules of the SQL feed to timeline posts: plain
+// reposts whose original is gone are dropped, and an item shared several
+// times is only kept at its newest entry.
+func dedupFeed(posts []store.PostWithMetadata) []store.PostWithMetadata {
+	seen := make(map[int64]bool, len(posts))
+	deduped := posts[:0]
+
+	for _, p := range posts {
+		item := p.ID
+		if p.IsPlainRepost() {
+			if p.Original == nil {
+				continue
+			}
+			item = *p.RepostOfID
+		}
+
+		if seen[item] {
+			continue
+		}
+		seen[item] = true
+		deduped = append(deduped, p)
+	}
+
+	return deduped
+}
@@ -14,18 +14,13 @@ import (
 
 type UserKey string
 
-const userCtx UserKey = "user"
+const (
+	userCtx        UserKey = "user"
+	profileUserCtx UserKey = "profileUser"
+)
 
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
-
-	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
-
-	ctx := r.Context()
-	user, err := app.getUser(ctx, userID)
+	user := getProfileUserFromCtx(r)
 
 	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
 		app.internalServerError(w, r, err)
@@ -53,6 +48,15 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// the timeline lacks the posts of the followed user; it is rebuilt on
+	// the next read
+	if app.config.redisCfg.enabled {
+		if err := app.cacheStorage.Timelines.Invalidate(r.Context(), followerUser.ID); err != nil {
+			app.logger.Errorw("error invalidating timeline", "user", followerUser.ID, "error", err)
+		}
+	}
+
+	app.notify(r.Context(), followedID, followerUser, Notification{Kind: NotificationFollow})
 }
 
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -69,6 +73,12 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		app.internalServerError(w, r, err)
 		return
 	}
+
+	if app.config.redisCfg.enabled {
+		if err := app.cacheStorage.Timelines.RemoveAuthor(r.Context(), unfollowerUser.ID, followedID); err != nil {
+			app.logger.Errorw("error removing unfollowed posts from timeline", "user", unfollowerUser.ID, "error", err)
+		}
+	}
 }
 
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -95,6 +105,8 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+// userContextMiddleware loads the user named by the userID path parameter.
+// It is stored apart from the authenticated user, see getProfileUserFromCtx.
 func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
@@ -105,7 +117,7 @@ func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 
 		ctx := r.Context()
 
-		user, err := app.store.Users.GetByID(ctx, userID)
+		user, err := app.getUser(ctx, userID)
 		if err != nil {
 			switch {
 			case errors.Is(err, store.ErrNotFound):
@@ -115,11 +127,19 @@ func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 			}
 			return
 		}
-		ctx = context.WithValue(ctx, userCtx, user)
+		ctx = context.WithValue(ctx, profileUserCtx, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func getProfileUserFromCtx(r *http.Request) *store.User {
+	user, ok := r.Context().Value(profileUserCtx).(*store.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
 func getUserFromContext(r *http.Request) *store.User {
 	user, ok := r.Context().Value(userCtx).(*store.User)
 	if !ok {
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/pubsub"
+	"github.com/Pedro-Foramilio/social/internal/store"
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+)
+
+// The WebSocket gateway exchanges JSON text messages. Clients send
+// wsRequest: subscribe and unsubscribe to a topic, typing on a post or
+// conversation topic they are subscribed to, and ping. The server answers
+// with subscribed, unsubscribed, pong and error messages, and delivers the
+// events of the subscribed topics as event messages.
+//
+// Topics:
+//   - post:<id>: new comments on the post and users typing a comment
+//   - conversation:<comment id>: new replies within the comment thread and
+//     users typing a reply
+//   - user:<id>: presence changes of the user; for the connected user, also
+//     the live events streamed by /v1/users/me/events
+
+const (
+	topicPost         = "post"
+	topicConversation = "conversation"
+	topicUser         = "user"
+)
+
+const (
+	eventTyping   = "typing"
+	eventPresence = "presence"
+)
+
+// wsReadLimit caps the size of client messages, which are only commands.
+const wsReadLimit = 4096
+
+var errTopicNotFound = errors.New("topic not found")
+
+type wsRequest struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic"`
+}
+
+type wsMessage struct {
+	Type  string          `json:"type"`
+	Topic string          `json:"topic,omitempty"`
+	Event string          `json:"event,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+	// RetryAfter is the number of seconds to wait after exceeding the rate
+	// limit.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+type Presence struct {
+	UserID int64 `json:"user_id"`
+	Online bool  `json:"online"`
+}
+
+type Typing struct {
+	User Actor `json:"user"`
+}
+
+func postEventsChannel(postID int64) string {
+	return fmt.Sprintf("post-events-%d", postID)
+}
+
+func conversationEventsChannel(commentID int64) string {
+	return fmt.Sprintf("conversation-events-%d", commentID)
+}
+
+func presenceEventsChannel(userID int64) string {
+	return fmt.Sprintf("presence-events-%d", userID)
+}
+
+// streamComment sends a new comment to the post topic and to the
+// conversation topics of the comments it replies to.
+func (app *application) streamComment(ctx context.Context, comment *store.Comment) {
+	channels := []string{postEventsChannel(comment.PostID)}
+
+	if comment.ParentID != nil {
+		ancestors, err := app.store.Comments.GetAncestorIDs(ctx, comment.ID)
+		if err != nil {
+			app.logger.Errorw("error streaming comment", "comment", comment.ID, "error", err)
+		}
+		for _, id := range ancestors {
+			channels = append(channels, conversationEventsChannel(id))
+		}
+	}
+
+	app.publish(ctx, channels, streamEvent{Type: eventComment}, comment)
+}
+
+// wsHandler upgrades the request to a WebSocket connection of the
+// authenticated user and serves it until either side closes it.
+func (app *application) wsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	// the hijacked connection keeps the server's deadlines, which would cut
+	// it; the gateway bounds each write itself
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// clients authenticate with the Authorization header, which browsers do
+	// not attach on their own, so any origin may connect
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
+	if err != nil {
+		app.logger.Warnw("websocket upgrade failed", "user", user.ID, "error", err)
+		return
+	}
+	conn.SetReadLimit(wsReadLimit)
+
+	app.background.Add(1)
+	defer app.background.Done()
+
+	c := &wsConn{
+		app:  app,
+		conn: conn,
+		user: user,
+		id:   uuid.New().String(),
+		send: make(chan wsMessage, app.config.events.buffer),
+		subs: make(map[string]*wsSubscription),
+	}
+
+	base := context.WithoutCancel(r.Context())
+	ctx, cancel := context.WithCancel(base)
+
+	c.connect(ctx)
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		c.writeLoop(ctx)
+	}()
+	c.readLoop(ctx)
+
+	// the write loop refreshes the presence of the connection, so it has to
+	// be gone before the connection is taken out of it
+	cancel()
+	<-written
+	c.disconnect(base)
+}
+
+type wsConn struct {
+	app  *application
+	conn *websocket.Conn
+	user *store.User
+	id   string
+	// send queues the messages for the client. A client that lets it fill
+	// up is disconnected.
+	send chan wsMessage
+
+	// subs is only used by the read loop.
+	subs map[string]*wsSubscription
+
+	closeOnce sync.Once
+}
+
+type wsSubscription struct {
+	sub pubsub.Subscription
+	// stop tells the forwarder that the subscription is closed on purpose.
+	stop chan struct{}
+}
+
+// close closes the connection once, with a close frame telling why.
+func (c *wsConn) close(code websocket.StatusCode, reason string) {
+	c.closeOnce.Do(func() {
+		go c.conn.Close(code, reason)
+	})
+}
+
+// enqueue queues msg for the client, or disconnects the client when it
+// does not keep up.
+func (c *wsConn) enqueue(msg wsMessage) {
+	select {
+	case c.send <- msg:
+	default:
+		c.close(websocket.StatusTryAgainLater, "too slow")
+	}
+}
+
+func (c *wsConn) sendError(topic string, err error) {
+	c.enqueue(wsMessage{Type: "error", Topic: topic, Error: err.Error()})
+}
+
+func (c *wsConn) connect(ctx context.Context) {
+	first, err := c.app.presence.Connect(ctx, c.user.ID, c.id)
+	if err != nil {
+		c.app.logger.Errorw("error tracking presence", "user", c.user.ID, "error", err)
+		return
+	}
+
+	if first {
+		c.publishPresence(ctx, true)
+	}
+}
+
+func (c *wsConn) disconnect(ctx context.Context) {
+	for topic := range c.subs {
+		c.unsubscribe(topic)
+	}
+
+	last, err := c.app.presence.Disconnect(ctx, c.user.ID, c.id)
+	if err != nil {
+		c.app.logger.Errorw("error tracking presence", "user", c.user.ID, "error", err)
+	}
+
+	if last {
+		c.publishPresence(ctx, false)
+	}
+
+	c.conn.CloseNow()
+}
+
+func (c *wsConn) publishPresence(ctx context.Context, online bool) {
+	c.app.publish(ctx, []string{presenceEventsChannel(c.user.ID)}, streamEvent{Type: eventPresence}, Presence{UserID: c.user.ID, Online: online})
+}
+
+// writeLoop writes the queued messages and the heartbeats until ctx is
+// done or the server shuts down.
+func (c *wsConn) writeLoop(ctx context.Context) {
+	heartbeat := time.NewTicker(c.app.config.events.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.app.closing:
+			c.close(websocket.StatusGoingAway, "server shutting down")
+			return
+		case msg := <-c.send:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				c.app.logger.Errorw("error encoding websocket message", "error", err)
+				continue
+			}
+
+			wctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err = c.conn.Write(wctx, websocket.MessageText, data)
+			cancel()
+			if err != nil {
+				c.close(websocket.StatusPolicyViolation, "write timeout")
+				return
+			}
+		case <-heartbeat.C:
+			pctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := c.conn.Ping(pctx)
+			cancel()
+			if err != nil {
+				c.close(websocket.StatusPolicyViolation, "heartbeat timeout")
+				return
+			}
+
+			if err := c.app.presence.Refresh(ctx, c.user.ID, c.id); err != nil {
+				c.app.logger.Errorw("error tracking presence", "user", c.user.ID, "error", err)
+			}
+		}
+	}
+}
+
+// readLoop handles the client's messages until the connection is closed.
+func (c *wsConn) readLoop(ctx context.Context) {
+	limiter := c.app.config.ws.rateLimiter
+
+	for {
+		typ, data, err := c.conn.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		if limiter.Enabled {
+			if allow, retryAfter := c.app.wsLimiter.Allow(c.id); !allow {
+				c.enqueue(wsMessage{Type: "error", Error: "rate limit exceeded", RetryAfter: int(retryAfter.Seconds())})
+				continue
+			}
+		}
+
+		var req wsRequest
+		if typ != websocket.MessageText || json.Unmarshal(data, &req) != nil {
+			c.sendError("", errors.New("messages must be JSON text"))
+			continue
+		}
+
+		switch req.Type {
+		case "subscribe":
+			c.subscribe(ctx, req.Topic)
+		case "unsubscribe":
+			if c.unsubscribe(req.Topic) {
+				c.enqueue(wsMessage{Type: "unsubscribed", Topic: req.Topic})
+			} else {
+				c.sendError(req.Topic, errors.New("not subscribed"))
+			}
+		case "typing":
+			c.typing(ctx, req.Topic)
+		case "ping":
+			c.enqueue(wsMessage{Type: "pong"})
+		default:
+			c.sendError(req.Topic, fmt.Errorf("unknown message type %q", req.Type))
+		}
+	}
+}
+
+func parseTopic(topic string) (string, int64, error) {
+	kind, id, ok := strings.Cut(topic, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid topic %q", topic)
+	}
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n < 1 {
+		return "", 0, fmt.Errorf("invalid topic %q", topic)
+	}
+
+	switch kind {
+	case topicPost, topicConversation, topicUser:
+		return kind, n, nil
+	default:
+		return "", 0, fmt.Errorf("invalid topic %q", topic)
+	}
+}
+
+// topicChannels checks that the user may subscribe to topic and returns
+// the broker channels behind it.
+func (c *wsConn) topicChannels(ctx context.Context, kind string, id int64) ([]string, error) {
+	postID := id
+
+	switch kind {
+	case topicUser:
+		if _, err := c.app.store.Users.GetByID(ctx, id); err != nil {
+			return nil, err
+		}
+		if id == c.user.ID {
+			return []string{presenceEventsChannel(id), userEventsChannel(id)}, nil
+		}
+		// presence is only shared between users where one follows the other
+		connected, err := c.app.store.Followers.IsConnected(ctx, c.user.ID, id)
+		if err != nil {
+			return nil, err
+		}
+		if !connected {
+			return nil, store.ErrNotFound
+		}
+		return []string{presenceEventsChannel(id)}, nil
+	case topicConversation:
+		comment, err := c.app.store.Comments.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		postID = comment.PostID
+	}
+
+	post, err := c.app.store.Posts.GetByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	visible, err := c.app.store.Posts.CanView(ctx, post.ID, c.user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if post.Status != store.PostStatusPublished || !visible {
+		return nil, store.ErrNotFound
+	}
+
+	if kind == topicConversation {
+		return []string{conversationEventsChannel(id)}, nil
+	}
+	return []string{postEventsChannel(id)}, nil
+}
+
+func (c *wsConn) subscribe(ctx context.Context, topic string) {
+	if _, ok := c.subs[topic]; ok {
+		c.enqueue(wsMessage{Type: "subscribed", Topic: topic})
+		return
+	}
+
+	kind, id, err := parseTopic(topic)
+	if err != nil {
+		c.sendError(topic, err)
+		return
+	}
+
+	if len(c.subs) >= c.app.config.ws.maxTopics {
+		c.sendError(topic, fmt.Errorf("cannot subscribe to more than %d topics", c.app.config.ws.maxTopics))
+		return
+	}
+
+	channels, err := c.topicChannels(ctx, kind, id)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			c.app.logger.Errorw("error subscribing to topic", "topic", topic, "error", err)
+			err = errors.New("the server encountered a problem")
+		} else {
+			err = errTopicNotFound
+		}
+		c.sendError(topic, err)
+		return
+	}
+
+	sub, err := c.app.broker.Subscribe(ctx, channels...)
+	if err != nil {
+		c.app.logger.Errorw("error subscribing to topic", "topic", topic, "error", err)
+		c.sendError(topic, errors.New("the server encountered a problem"))
+		return
+	}
+
+	s := &wsSubscription{sub: sub, stop: make(chan struct{})}
+	c.subs[topic] = s
+	go c.forward(topic, s)
+
+	c.enqueue(wsMessage{Type: "subscribed", Topic: topic})
+
+	if kind == topicUser {
+		online, err := c.app.presence.Online(ctx, id)
+		if err != nil {
+			c.app.logger.Errorw("error reading presence", "user", id, "error", err)
+			return
+		}
+
+		data, _ := json.Marshal(Presence{UserID: id, Online: online})
+		c.enqueue(wsMessage{Type: "event", Topic: topic, Event: eventPresence, Data: data})
+	}
+}
+
+func (c *wsConn) unsubscribe(topic string) bool {
+	s, ok := c.subs[topic]
+	if !ok {
+		return false
+	}
+
+	delete(c.subs, topic)
+	close(s.stop)
+	s.sub.Close()
+
+	return true
+}
+
+// forward relays the events of a subscription to the client, except the
+// ones the user sent. A subscription dropped by the broker for falling
+// behind disconnects the client.
+func (c *wsConn) forward(topic string, s *wsSubscription) {
+	for msg := range s.sub.Messages() {
+		var ev streamEvent
+		if err := json.Unmarshal(msg.Data, &ev); err != nil {
+			c.app.logger.Errorw("error decoding event", "error", err)
+			continue
+		}
+
+		if ev.Sender == c.user.ID {
+			continue
+		}
+
+		c.enqueue(wsMessage{Type: "event", Topic: topic, Event: ev.Type, Data: ev.Data})
+	}
+
+	select {
+	case <-s.stop:
+	default:
+		c.close(websocket.StatusTryAgainLater, "too slow")
+	}
+}
+
+// typing tells the other subscribers of a post or conversation topic that
+// the user is typing.
+func (c *wsConn) typing(ctx context.Context, topic string) {
+	kind, id, err := parseTopic(topic)
+	if err != nil {
+		c.sendError(topic, err)
+		return
+	}
+
+	if _, ok := c.subs[topic]; !ok || kind == topicUser {
+		c.sendError(topic, errors.New("typing requires a subscribed post or conversation topic"))
+		return
+	}
+
+	channel := postEventsChannel(id)
+	if kind == topicConversation {
+		channel = conversationEventsChannel(id)
+	}
+
+	typing := Typing{User: Actor{ID: c.user.ID, Username: c.user.Username}}
+	c.app.publish(ctx, []string{channel}, streamEvent{Type: eventTyping, Sender: c.user.ID}, typing)
+}
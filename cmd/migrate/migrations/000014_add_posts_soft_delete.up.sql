@@ -0,0 +1,7 @@
+ALTER TABLE posts
+ADD COLUMN deleted_at TIMESTAMP(0) WITH TIME ZONE;
+
+ALTER TABLE posts
+ADD COLUMN deleted_by BIGINT REFERENCES users(id);
+
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
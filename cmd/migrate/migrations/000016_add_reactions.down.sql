@@ -0,0 +1,7 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS reaction_counts;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS reaction_counts;
+
+DROP TABLE IF EXISTS comment_reactions;
+
+DROP TABLE IF EXISTS post_reactions;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_posts_unique_repost;
+
+DROP INDEX IF EXISTS idx_posts_repost_of_id;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS repost_count;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS is_quote;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS repost_of_id;
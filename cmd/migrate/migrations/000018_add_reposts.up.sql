@@ -0,0 +1,14 @@
+ALTER TABLE posts
+ADD COLUMN repost_of_id BIGINT REFERENCES posts(id) ON DELETE SET NULL;
+
+ALTER TABLE posts
+ADD COLUMN is_quote BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE posts
+ADD COLUMN repost_count INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_posts_repost_of_id ON posts (repost_of_id) WHERE repost_of_id IS NOT NULL;
+
+-- a user can plainly repost a given post only once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_unique_repost ON posts (user_id, repost_of_id)
+    WHERE repost_of_id IS NOT NULL AND NOT is_quote AND deleted_at IS NULL;
@@ -0,0 +1,22 @@
+ALTER TABLE posts
+ADD COLUMN content_format VARCHAR(20) NOT NULL DEFAULT 'plain'
+    CHECK (content_format IN ('plain', 'markdown'));
+
+ALTER TABLE posts
+ADD COLUMN content_html TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE comments
+ADD COLUMN content_format VARCHAR(20) NOT NULL DEFAULT 'plain'
+    CHECK (content_format IN ('plain', 'markdown'));
+
+ALTER TABLE comments
+ADD COLUMN content_html TEXT NOT NULL DEFAULT '';
+
+-- existing content is plain text: escape it the same way markup.Render does
+UPDATE posts SET content_html = '<p>' || replace(replace(replace(replace(replace(replace(
+    content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;'), E'\n', E'<br>\n') || '</p>'
+WHERE content <> '';
+
+UPDATE comments SET content_html = '<p>' || replace(replace(replace(replace(replace(replace(
+    content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;'), E'\n', E'<br>\n') || '</p>'
+WHERE content <> '';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_followers_follower_id;
+
+DROP TABLE IF EXISTS post_mentions;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS tag_usage (
+    tag VARCHAR(100) NOT NULL,
+    bucket TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    count INT NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (tag, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tag_usage_bucket ON tag_usage (bucket);
+
+-- tags written before hashtag extraction were stored exactly as sent
+UPDATE posts
+SET tags = ARRAY(
+    SELECT n.tag
+    FROM (
+        SELECT lower(normalize(ltrim(btrim(t), '#'), NFKC)) AS tag, MIN(ord) AS ord
+        FROM unnest(posts.tags) WITH ORDINALITY AS u(t, ord)
+        GROUP BY 1
+    ) n
+    WHERE n.tag <> ''
+    ORDER BY n.ord
+)
+WHERE cardinality(tags) > 0;
+
+INSERT INTO tag_usage (tag, bucket, count)
+SELECT t, date_trunc('hour', p.created_at), COUNT(*)
+FROM posts p, unnest(p.tags) AS t
+WHERE p.status = 'published' AND p.deleted_at IS NULL
+GROUP BY 1, 2;
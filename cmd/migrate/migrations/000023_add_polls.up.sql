@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS polls (
+    post_id BIGINT PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    voter_count INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id BIGSERIAL PRIMARY KEY,
+    post_id BIGINT NOT NULL REFERENCES polls(post_id) ON DELETE CASCADE,
+    position SMALLINT NOT NULL,
+    text VARCHAR(100) NOT NULL,
+    vote_count INT NOT NULL DEFAULT 0,
+
+    UNIQUE (post_id, position)
+);
+
+-- one row per user and poll, so a user can only vote once
+CREATE TABLE IF NOT EXISTS poll_voters (
+    post_id BIGINT NOT NULL REFERENCES polls(post_id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    option_id BIGINT NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    PRIMARY KEY (option_id, user_id)
+);
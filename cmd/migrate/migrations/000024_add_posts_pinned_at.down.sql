@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_user_id_created_at;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS pinned_at;
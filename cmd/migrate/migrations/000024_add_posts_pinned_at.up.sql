@@ -0,0 +1,4 @@
+ALTER TABLE posts
+ADD COLUMN pinned_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts (user_id, created_at DESC);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_comments_parent_id;
+DROP INDEX IF EXISTS idx_comments_post_id_top_level;
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS reply_count,
+DROP COLUMN IF EXISTS depth,
+DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,7 @@
+ALTER TABLE comments
+ADD COLUMN parent_id BIGINT REFERENCES comments(id) ON DELETE CASCADE,
+ADD COLUMN depth SMALLINT NOT NULL DEFAULT 0,
+ADD COLUMN reply_count INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id_top_level ON comments (post_id, created_at) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id, created_at);
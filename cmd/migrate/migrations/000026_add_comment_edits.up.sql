@@ -0,0 +1,3 @@
+ALTER TABLE comments
+ADD COLUMN edited_at TIMESTAMP(0) WITH TIME ZONE,
+ADD COLUMN deleted_at TIMESTAMP(0) WITH TIME ZONE;
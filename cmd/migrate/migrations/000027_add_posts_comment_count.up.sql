@@ -0,0 +1,6 @@
+ALTER TABLE posts
+ADD COLUMN comment_count INT NOT NULL DEFAULT 0;
+
+UPDATE posts p SET comment_count = (
+    SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL
+);
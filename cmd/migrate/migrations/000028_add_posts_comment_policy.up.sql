@@ -0,0 +1,3 @@
+ALTER TABLE posts
+ADD COLUMN comment_policy VARCHAR(20) NOT NULL DEFAULT 'open'
+    CHECK (comment_policy IN ('open', 'followers', 'mentioned', 'locked'));
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_user_id_created_at;
+
+DROP INDEX IF EXISTS idx_post_reactions_user_id_created_at;
@@ -0,0 +1,25 @@
+DROP INDEX IF EXISTS idx_users_search_vector;
+
+DROP INDEX IF EXISTS idx_comments_search_vector;
+
+DROP INDEX IF EXISTS idx_posts_search_vector;
+
+DROP TRIGGER IF EXISTS posts_language_changed ON posts;
+
+DROP FUNCTION IF EXISTS posts_language_changed();
+
+DROP TRIGGER IF EXISTS comments_search_vector ON comments;
+
+DROP FUNCTION IF EXISTS comments_search_vector();
+
+DROP TRIGGER IF EXISTS posts_search_vector ON posts;
+
+DROP FUNCTION IF EXISTS posts_search_vector();
+
+ALTER TABLE users DROP COLUMN IF EXISTS search_vector;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS search_vector;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS search_vector;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS language;
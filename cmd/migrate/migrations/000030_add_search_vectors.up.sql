@@ -0,0 +1,69 @@
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS language regconfig NOT NULL DEFAULT 'english';
+
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+ALTER TABLE comments
+ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+-- usernames are matched as written, without stemming
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', username)) STORED;
+
+CREATE OR REPLACE FUNCTION posts_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector(NEW.language, COALESCE(NEW.title, '')), 'A') ||
+        setweight(to_tsvector(NEW.language, COALESCE(NEW.content, '')), 'B') ||
+        setweight(to_tsvector(NEW.language, array_to_string(NEW.tags, ' ')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_search_vector
+BEFORE INSERT OR UPDATE OF title, content, tags, language ON posts
+FOR EACH ROW EXECUTE FUNCTION posts_search_vector();
+
+-- comments are stemmed in the language of their post
+CREATE OR REPLACE FUNCTION comments_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := to_tsvector(
+        (SELECT language FROM posts WHERE id = NEW.post_id),
+        COALESCE(NEW.content, '')
+    );
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comments_search_vector
+BEFORE INSERT OR UPDATE OF content ON comments
+FOR EACH ROW EXECUTE FUNCTION comments_search_vector();
+
+CREATE OR REPLACE FUNCTION posts_language_changed() RETURNS trigger AS $$
+BEGIN
+    UPDATE comments SET search_vector = to_tsvector(NEW.language, content) WHERE post_id = NEW.id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_language_changed
+AFTER UPDATE OF language ON posts
+FOR EACH ROW WHEN (OLD.language IS DISTINCT FROM NEW.language)
+EXECUTE FUNCTION posts_language_changed();
+
+UPDATE posts SET
+    search_vector =
+        setweight(to_tsvector(language, COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector(language, COALESCE(content, '')), 'B') ||
+        setweight(to_tsvector(language, array_to_string(tags, ' ')), 'C');
+
+UPDATE comments c SET search_vector = to_tsvector(p.language, COALESCE(c.content, ''))
+FROM posts p
+WHERE p.id = c.post_id;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING GIN (search_vector);
+
+CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING GIN (search_vector);
+
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector);
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS posts_feed_updated ON posts;
+
+DROP TRIGGER IF EXISTS posts_feed_changed ON posts;
+
+DROP FUNCTION IF EXISTS posts_feed_changed();
+
+DROP TABLE IF EXISTS tag_feed_changes;
+
+DROP TABLE IF EXISTS user_feed_changes;
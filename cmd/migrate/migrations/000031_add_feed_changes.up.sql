@@ -0,0 +1,54 @@
+-- When the syndication feeds of each user and tag last changed. Every write
+-- to posts bumps its author and its tags, before and after the write, so the
+-- time never goes back when a post leaves a feed (deleted, purged,
+-- unpublished, hidden or untagged). No foreign key: rows of deleted users
+-- are bumped while their posts cascade.
+CREATE TABLE IF NOT EXISTS user_feed_changes (
+    user_id BIGINT PRIMARY KEY,
+    changed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS tag_feed_changes (
+    tag VARCHAR(100) PRIMARY KEY,
+    changed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION posts_feed_changed() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO user_feed_changes (user_id, changed_at)
+    SELECT DISTINCT u, NOW()
+    FROM unnest(ARRAY[OLD.user_id, NEW.user_id]) AS u
+    WHERE u IS NOT NULL
+    ON CONFLICT (user_id) DO UPDATE
+    SET changed_at = GREATEST(user_feed_changes.changed_at, EXCLUDED.changed_at);
+
+    INSERT INTO tag_feed_changes (tag, changed_at)
+    SELECT DISTINCT t, NOW()
+    FROM unnest(COALESCE(OLD.tags, '{}') || COALESCE(NEW.tags, '{}')) AS t
+    ON CONFLICT (tag) DO UPDATE
+    SET changed_at = GREATEST(tag_feed_changes.changed_at, EXCLUDED.changed_at);
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_feed_changed
+AFTER INSERT OR DELETE ON posts
+FOR EACH ROW EXECUTE FUNCTION posts_feed_changed();
+
+-- counters (comments, reactions, reposts) are not part of the feeds
+CREATE TRIGGER posts_feed_updated
+AFTER UPDATE OF user_id, title, content, content_html, tags, status, visibility, created_at, updated_at, deleted_at ON posts
+FOR EACH ROW EXECUTE FUNCTION posts_feed_changed();
+
+INSERT INTO user_feed_changes (user_id, changed_at)
+SELECT user_id, MAX(GREATEST(created_at, updated_at, deleted_at))
+FROM posts
+GROUP BY user_id
+ON CONFLICT DO NOTHING;
+
+INSERT INTO tag_feed_changes (tag, changed_at)
+SELECT t, MAX(GREATEST(p.created_at, p.updated_at, p.deleted_at))
+FROM posts p, unnest(p.tags) AS t
+GROUP BY t
+ON CONFLICT DO NOTHING;
@@ -41,3 +41,17 @@ func GetBool(key string, defaultValue bool) bool {
 	}
 	return boolVal
 }
+
+func GetFloat(key string, defaultValue float64) float64 {
+
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+
+	floatVal, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return floatVal
+}
@@ -0,0 +1,80 @@
+package markup
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w{1,50})`)
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_&#/])#([\p{L}\p{M}\p{N}_]{1,50})`)
+)
+
+// ExtractMentions returns the distinct usernames mentioned as @username in
+// source, in order of first appearance.
+func ExtractMentions(source string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(source, -1) {
+		username := match[1]
+		if !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+
+	return usernames
+}
+
+// ExtractHashtags returns the distinct, normalized #hashtags in source, in
+// order of first appearance. Tags made only of digits and underscores, such
+// as "#1", are not hashtags.
+func ExtractHashtags(source string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, match := range hashtagPattern.FindAllStringSubmatch(source, -1) {
+		tag := NormalizeTag(match[1])
+		if !strings.ContainsFunc(tag, unicode.IsLetter) || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// NormalizeTag returns the canonical form of a tag: without the leading '#',
+// NFKC-normalized and lower-cased, so "#Café" and "ＣＡＦÉ" are the same tag.
+func NormalizeTag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	tag = strings.TrimLeft(tag, "#")
+	tag = norm.NFKC.String(tag)
+	tag = strings.ToLower(tag)
+	// case mapping can leave the string outside NFC for a few characters
+	return norm.NFC.String(tag)
+}
+
+// MergeTags normalizes the explicit tags, appends the hashtags found in
+// content and drops empty values and duplicates.
+func MergeTags(explicit []string, content string) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+
+	for _, tag := range slices.Concat(explicit, ExtractHashtags(content)) {
+		tag = NormalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
@@ -0,0 +1,64 @@
+package markup
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+var (
+	markdown = goldmark.New(
+		goldmark.WithExtensions(
+			extension.Strikethrough,
+			extension.Linkify,
+			extension.Table,
+		),
+	)
+
+	// policy allows the formatting produced by Markdown and strips anything
+	// executable: scripts, event handler attributes and non http(s)/mailto URLs.
+	policy = newPolicy()
+)
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+// Render converts user content to HTML that is safe to embed in a page.
+// Plain text is escaped; Markdown is rendered and then sanitized.
+func Render(format, source string) (string, error) {
+	switch format {
+	case "", FormatPlain:
+		return renderPlain(source), nil
+	case FormatMarkdown:
+		var buf bytes.Buffer
+		if err := markdown.Convert([]byte(source), &buf); err != nil {
+			return "", err
+		}
+		return policy.Sanitize(buf.String()), nil
+	default:
+		return "", fmt.Errorf("unknown content format %q", format)
+	}
+}
+
+func renderPlain(source string) string {
+	if source == "" {
+		return ""
+	}
+
+	escaped := html.EscapeString(source)
+	return "<p>" + strings.ReplaceAll(escaped, "\n", "<br>\n") + "</p>"
+}
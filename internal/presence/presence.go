@@ -0,0 +1,72 @@
+package presence
+
+import (
+	"context"
+	"sync"
+)
+
+// Tracker records the live connections of users, to tell whether they are
+// online. Connections are identified by an ID unique across instances.
+type Tracker interface {
+	// Connect registers a connection and reports whether it is the first
+	// one of the user, i.e. whether the user just came online.
+	Connect(ctx context.Context, userID int64, connID string) (bool, error)
+	// Refresh keeps a connection registered. Trackers shared by several
+	// instances forget connections that are not refreshed in time, so that
+	// the connections of a crashed instance go away.
+	Refresh(ctx context.Context, userID int64, connID string) error
+	// Disconnect removes a connection and reports whether it was the last
+	// one of the user, i.e. whether the user just went offline.
+	Disconnect(ctx context.Context, userID int64, connID string) (bool, error)
+	Online(ctx context.Context, userID int64) (bool, error)
+}
+
+// MemoryTracker tracks the connections of a single instance.
+type MemoryTracker struct {
+	mu    sync.Mutex
+	conns map[int64]map[string]struct{}
+}
+
+func NewMemoryTracker() *MemoryTracker {
+	return &MemoryTracker{conns: make(map[int64]map[string]struct{})}
+}
+
+func (t *MemoryTracker) Connect(ctx context.Context, userID int64, connID string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conns[userID] == nil {
+		t.conns[userID] = make(map[string]struct{})
+	}
+	t.conns[userID][connID] = struct{}{}
+
+	return len(t.conns[userID]) == 1, nil
+}
+
+func (t *MemoryTracker) Refresh(ctx context.Context, userID int64, connID string) error {
+	return nil
+}
+
+func (t *MemoryTracker) Disconnect(ctx context.Context, userID int64, connID string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.conns[userID][connID]; !ok {
+		return false, nil
+	}
+
+	delete(t.conns[userID], connID)
+	if len(t.conns[userID]) > 0 {
+		return false, nil
+	}
+
+	delete(t.conns, userID)
+	return true, nil
+}
+
+func (t *MemoryTracker) Online(ctx context.Context, userID int64) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.conns[userID]) > 0, nil
+}
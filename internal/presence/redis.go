@@ -0,0 +1,89 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisTracker shares connections between instances. The connections of a
+// user are kept in the sorted set presence-<user id>, scored by the time
+// they expire unless refreshed.
+type RedisTracker struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func NewRedisTracker(rdb *redis.Client, ttl time.Duration) *RedisTracker {
+	return &RedisTracker{rdb: rdb, ttl: ttl}
+}
+
+func presenceKey(userID int64) string {
+	return fmt.Sprintf("presence-%d", userID)
+}
+
+// prune drops the expired connections of key.
+func prune(ctx context.Context, pipe redis.Pipeliner, key string) {
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+}
+
+func (t *RedisTracker) register(ctx context.Context, pipe redis.Pipeliner, key, connID string) {
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(time.Now().Add(t.ttl).UnixMilli()), Member: connID})
+	pipe.Expire(ctx, key, t.ttl)
+}
+
+func (t *RedisTracker) Connect(ctx context.Context, userID int64, connID string) (bool, error) {
+	key := presenceKey(userID)
+
+	var before *redis.IntCmd
+	_, err := t.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		prune(ctx, pipe, key)
+		before = pipe.ZCard(ctx, key)
+		t.register(ctx, pipe, key, connID)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return before.Val() == 0, nil
+}
+
+func (t *RedisTracker) Refresh(ctx context.Context, userID int64, connID string) error {
+	key := presenceKey(userID)
+
+	_, err := t.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		t.register(ctx, pipe, key, connID)
+		return nil
+	})
+	return err
+}
+
+func (t *RedisTracker) Disconnect(ctx context.Context, userID int64, connID string) (bool, error) {
+	key := presenceKey(userID)
+
+	var removed, after *redis.IntCmd
+	_, err := t.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.ZRem(ctx, key, connID)
+		prune(ctx, pipe, key)
+		after = pipe.ZCard(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return removed.Val() == 1 && after.Val() == 0, nil
+}
+
+func (t *RedisTracker) Online(ctx context.Context, userID int64) (bool, error) {
+	n, err := t.rdb.ZCount(ctx, presenceKey(userID), strconv.FormatInt(time.Now().UnixMilli(), 10), "+inf").Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
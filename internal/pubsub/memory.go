@@ -0,0 +1,32 @@
+package pubsub
+
+import "context"
+
+// MemoryBroker delivers messages within the process, for single instance
+// deployments.
+type MemoryBroker struct {
+	hub *hub
+}
+
+// NewMemoryBroker returns a broker whose subscribers may fall behind by up
+// to buffer messages.
+func NewMemoryBroker(buffer int) *MemoryBroker {
+	return &MemoryBroker{hub: newHub(buffer)}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, data []byte, channels ...string) error {
+	for _, ch := range channels {
+		b.hub.dispatch(Message{Channel: ch, Data: data})
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, channels ...string) (Subscription, error) {
+	s, _ := b.hub.subscribe(channels, nil)
+	return s, nil
+}
+
+func (b *MemoryBroker) Close() error {
+	b.hub.close()
+	return nil
+}
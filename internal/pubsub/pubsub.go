@@ -0,0 +1,142 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// Message is a payload published on a channel.
+type Message struct {
+	Channel string
+	Data    []byte
+}
+
+// Broker delivers the messages published on a channel to the current
+// subscribers of that channel, without persistence: subscribers only get
+// the messages published while they are subscribed.
+type Broker interface {
+	Publish(ctx context.Context, data []byte, channels ...string) error
+	Subscribe(ctx context.Context, channels ...string) (Subscription, error)
+	Close() error
+}
+
+// Subscription receives the messages of the channels it was created for.
+// Subscribers that fall behind by more than the broker's buffer are
+// dropped: their Messages channel is closed without Close being called.
+type Subscription interface {
+	Messages() <-chan Message
+	Close() error
+}
+
+// hub dispatches messages to the local subscribers of each channel.
+type hub struct {
+	mu     sync.Mutex
+	subs   map[string]map[*subscription]struct{}
+	buffer int
+	// unsubscribed is called with the channels left without subscribers
+	// when a subscription goes away, while mu is held.
+	unsubscribed func(channels []string)
+}
+
+func newHub(buffer int) *hub {
+	return &hub{subs: make(map[string]map[*subscription]struct{}), buffer: buffer}
+}
+
+// subscribe registers a subscription to channels. subscribed is called with
+// the channels that had no subscribers yet, while mu is held, and the
+// subscription is discarded if it fails.
+func (h *hub) subscribe(channels []string, subscribed func(channels []string) error) (*subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var first []string
+	for _, ch := range channels {
+		if len(h.subs[ch]) == 0 {
+			first = append(first, ch)
+		}
+	}
+
+	if len(first) > 0 && subscribed != nil {
+		if err := subscribed(first); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &subscription{hub: h, channels: channels, messages: make(chan Message, h.buffer)}
+	for _, ch := range channels {
+		if h.subs[ch] == nil {
+			h.subs[ch] = make(map[*subscription]struct{})
+		}
+		h.subs[ch][s] = struct{}{}
+	}
+
+	return s, nil
+}
+
+// remove drops s and closes its channel. It must be called with mu held.
+func (h *hub) remove(s *subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.messages)
+
+	var last []string
+	for _, ch := range s.channels {
+		delete(h.subs[ch], s)
+		if len(h.subs[ch]) == 0 {
+			delete(h.subs, ch)
+			last = append(last, ch)
+		}
+	}
+
+	if len(last) > 0 && h.unsubscribed != nil {
+		h.unsubscribed(last)
+	}
+}
+
+// dispatch hands msg to the subscribers of its channel, dropping the ones
+// whose buffer is full.
+func (h *hub) dispatch(msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs[msg.Channel] {
+		select {
+		case s.messages <- msg:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, subs := range h.subs {
+		for s := range subs {
+			h.remove(s)
+		}
+	}
+}
+
+type subscription struct {
+	hub      *hub
+	channels []string
+	messages chan Message
+	// closed is guarded by hub.mu.
+	closed bool
+}
+
+func (s *subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+func (s *subscription) Close() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.remove(s)
+	return nil
+}
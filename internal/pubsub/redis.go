@@ -0,0 +1,71 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisBroker delivers messages through Redis pub/sub, so that subscribers
+// get the messages published by every instance. Each instance holds a
+// single Redis subscription covering the channels of its local subscribers.
+type RedisBroker struct {
+	rdb    *redis.Client
+	ps     *redis.PubSub
+	hub    *hub
+	listen sync.Once
+}
+
+// NewRedisBroker returns a broker whose subscribers may fall behind by up to
+// buffer messages.
+func NewRedisBroker(rdb *redis.Client, buffer int) *RedisBroker {
+	b := &RedisBroker{
+		rdb: rdb,
+		ps:  rdb.Subscribe(context.Background()),
+		hub: newHub(buffer),
+	}
+
+	b.hub.unsubscribed = func(channels []string) {
+		// failures leave the channels subscribed, whose messages are then
+		// dispatched to nobody
+		b.ps.Unsubscribe(context.Background(), channels...)
+	}
+
+	return b
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, data []byte, channels ...string) error {
+	_, err := b.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, ch := range channels {
+			pipe.Publish(ctx, ch, data)
+		}
+		return nil
+	})
+	return err
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, channels ...string) (Subscription, error) {
+	s, err := b.hub.subscribe(channels, func(channels []string) error {
+		return b.ps.Subscribe(ctx, channels...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b.listen.Do(func() {
+		go func() {
+			for msg := range b.ps.Channel() {
+				b.hub.dispatch(Message{Channel: msg.Channel, Data: []byte(msg.Payload)})
+			}
+		}()
+	})
+
+	return s, nil
+}
+
+func (b *RedisBroker) Close() error {
+	err := b.ps.Close()
+	b.hub.close()
+	return err
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Attachment struct {
+	ID           int64  `json:"id"`
+	UserID       int64  `json:"user_id"`
+	PostID       *int64 `json:"post_id,omitempty"`
+	StorageKey   string `json:"-"`
+	ThumbnailKey string `json:"-"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	CreatedAt    string `json:"created_at"`
+}
+
+func (a *Attachment) setURLs() {
+	a.URL = fmt.Sprintf("/v1/attachments/%d/content", a.ID)
+	a.ThumbnailURL = fmt.Sprintf("/v1/attachments/%d/thumbnail", a.ID)
+}
+
+type AttachmentStore struct {
+	db *sql.DB
+}
+
+func (s *AttachmentStore) Create(ctx context.Context, attachment *Attachment) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO attachments (user_id, storage_key, thumbnail_key, content_type, size_bytes, width, height)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		attachment.UserID,
+		attachment.StorageKey,
+		attachment.ThumbnailKey,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.Width,
+		attachment.Height,
+	).Scan(
+		&attachment.ID,
+		&attachment.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	attachment.setURLs()
+	return nil
+}
+
+func (s *AttachmentStore) GetByID(ctx context.Context, id int64) (*Attachment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, post_id, storage_key, thumbnail_key, content_type, size_bytes, width, height, created_at
+		FROM attachments
+		WHERE id = $1
+	`
+
+	var a Attachment
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&a.ID,
+		&a.UserID,
+		&a.PostID,
+		&a.StorageKey,
+		&a.ThumbnailKey,
+		&a.ContentType,
+		&a.Size,
+		&a.Width,
+		&a.Height,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	a.setURLs()
+	return &a, nil
+}
+
+// DeleteOrphans removes up to limit attachments that were never attached to
+// a post, or whose post was purged, and returns them so the caller can delete
+// the stored blobs.
+func (s *AttachmentStore) DeleteOrphans(ctx context.Context, createdBefore time.Time, limit int) ([]Attachment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM attachments
+		WHERE id IN (
+			SELECT id FROM attachments
+			WHERE post_id IS NULL AND created_at < $1
+			ORDER BY created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, storage_key, thumbnail_key
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orphans []Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.StorageKey, &a.ThumbnailKey); err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, a)
+	}
+
+	return orphans, rows.Err()
+}
+
+// linkAttachments assigns the user's unattached uploads to a post. It fails
+// with ErrNotFound if any of them does not exist, belongs to someone else or
+// is already used by another post.
+func linkAttachments(ctx context.Context, tx *sql.Tx, postID, userID int64, ids []int64) error {
+	query := `
+		UPDATE attachments
+		SET post_id = $1
+		WHERE id = ANY($2) AND user_id = $3 AND post_id IS NULL
+	`
+
+	res, err := tx.ExecContext(ctx, query, postID, pq.Array(ids), userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected != int64(len(ids)) {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func attachAttachments(ctx context.Context, db *sql.DB, posts []*Post) error {
+	ids := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `
+		SELECT id, user_id, post_id, content_type, size_bytes, width, height, created_at
+		FROM attachments
+		WHERE post_id = ANY($1)
+		ORDER BY id
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byPost := make(map[int64][]Attachment)
+	for rows.Next() {
+		var a Attachment
+		err := rows.Scan(
+			&a.ID,
+			&a.UserID,
+			&a.PostID,
+			&a.ContentType,
+			&a.Size,
+			&a.Width,
+			&a.Height,
+			&a.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		a.setURLs()
+		byPost[*a.PostID] = append(byPost[*a.PostID], a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		p.Attachments = byPost[p.ID]
+		if p.Attachments == nil {
+			p.Attachments = []Attachment{}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Bookmark struct {
+	PostWithMetadata
+	CollectionID *int64    `json:"collection_id"`
+	BookmarkedAt time.Time `json:"bookmarked_at"`
+}
+
+type BookmarkCollection struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+	Count     int    `json:"count"`
+}
+
+type BookmarkQuery struct {
+	PaginatedFeedQuery
+	CollectionID *int64
+}
+
+type BookmarkStore struct {
+	db *sql.DB
+}
+
+// Add bookmarks a post for the user, moving it to collectionID if it was
+// already bookmarked. It returns ErrNotFound when the post is not visible or
+// the collection does not belong to the user.
+func (s *BookmarkStore) Add(ctx context.Context, userID, postID int64, collectionID *int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO bookmarks (user_id, post_id, collection_id)
+		SELECT $1, $2, $3
+		WHERE EXISTS (
+			SELECT 1 FROM posts p
+			WHERE p.id = $2 AND p.deleted_at IS NULL AND p.status = 'published' AND ` + visibleTo("p", "$1") + `
+		)
+		AND ($3::bigint IS NULL OR EXISTS (
+			SELECT 1 FROM bookmark_collections WHERE id = $3 AND user_id = $1
+		))
+		ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id
+	`
+
+	res, err := s.db.ExecContext(ctx, query, userID, postID, collectionID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *BookmarkStore) Remove(ctx context.Context, userID, postID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2`
+
+	_, err := s.db.ExecContext(ctx, query, userID, postID)
+	return err
+}
+
+func (s *BookmarkStore) IsBookmarked(ctx context.Context, userID, postID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT EXISTS (SELECT 1 FROM bookmarks WHERE user_id = $1 AND post_id = $2)`
+
+	var exists bool
+	err := s.db.QueryRowContext(ctx, query, userID, postID).Scan(&exists)
+	return exists, err
+}
+
+// List returns the user's bookmarks in bookmark time order (bq.Sort),
+// starting after bq.Position. since and until bound the bookmark time.
+// Bookmarks of posts that were deleted, unpublished or are no longer visible
+// to the user are skipped.
+func (s *BookmarkStore) List(ctx context.Context, userID int64, bq BookmarkQuery) ([]Bookmark, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	args := []any{userID, bq.Search}
+
+	query := `
+		SELECT ` + postWithMetadataColumns + `,
+		b.collection_id, b.created_at
+		FROM bookmarks b
+		JOIN posts p ON p.id = b.post_id
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN post_reactions r ON r.post_id = p.id AND r.user_id = $1
+		WHERE
+			b.user_id = $1
+			AND p.deleted_at IS NULL
+			AND p.status = 'published'
+			AND ` + visibleTo("p", "$1") + `
+			AND (p.title ILIKE '%' || $2 || '%' OR p.content ILIKE '%' || $2 || '%')
+	`
+
+	if len(bq.Tags) > 0 {
+		args = append(args, pq.Array(bq.Tags))
+		query += ` AND (p.tags @> $` + strconv.Itoa(len(args)) + `)`
+	}
+
+	if bq.CollectionID != nil {
+		args = append(args, *bq.CollectionID)
+		query += ` AND b.collection_id = $` + strconv.Itoa(len(args))
+	}
+
+	if bq.Since != "" {
+		args = append(args, bq.Since)
+		query += ` AND b.created_at >= $` + strconv.Itoa(len(args)) + `::timestamptz`
+	}
+
+	if bq.Until != "" {
+		args = append(args, bq.Until)
+		query += ` AND b.created_at < $` + strconv.Itoa(len(args)) + `::timestamptz`
+	}
+
+	if bq.Position != nil {
+		cmp := "<"
+		if bq.Sort == "asc" {
+			cmp = ">"
+		}
+		args = append(args, bq.Position.CreatedAt, bq.Position.ID)
+		query += ` AND (b.created_at, b.post_id) ` + cmp + ` ($` + strconv.Itoa(len(args)-1) + `, $` + strconv.Itoa(len(args)) + `)`
+	}
+
+	args = append(args, bq.Limit)
+	query += `
+		ORDER BY b.created_at ` + bq.Sort + `, b.post_id ` + bq.Sort + `
+		LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+
+	for rows.Next() {
+		var b Bookmark
+		b.PostWithMetadata, err = scanPostWithMetadata(rows, &b.CollectionID, &b.BookmarkedAt)
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	posts := make([]*Post, len(bookmarks))
+	for i := range bookmarks {
+		posts[i] = &bookmarks[i].Post
+	}
+
+	if err := hydratePosts(ctx, s.db, userID, posts); err != nil {
+		return nil, err
+	}
+
+	return bookmarks, nil
+}
+
+func (s *BookmarkStore) CreateCollection(ctx context.Context, collection *BookmarkCollection) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO bookmark_collections (user_id, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`
+
+	err := s.db.QueryRowContext(ctx, query, collection.UserID, collection.Name).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrAlredyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *BookmarkStore) GetCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT bc.id, bc.user_id, bc.name, bc.created_at, COUNT(p.id)
+		FROM bookmark_collections bc
+		LEFT JOIN bookmarks b ON b.collection_id = bc.id
+		LEFT JOIN posts p ON p.id = b.post_id AND p.deleted_at IS NULL AND p.status = 'published'
+		WHERE bc.user_id = $1
+		GROUP BY bc.id
+		ORDER BY bc.name
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []BookmarkCollection{}
+
+	for rows.Next() {
+		var c BookmarkCollection
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt, &c.Count); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+
+	return collections, rows.Err()
+}
+
+func (s *BookmarkStore) DeleteCollection(ctx context.Context, userID, collectionID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2`
+
+	res, err := s.db.ExecContext(ctx, query, collectionID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+type ExploreStore struct {
+	rbd *redis.Client
+}
+
+const exploreCacheKey = "explore-"
+
+// Get returns the cached explore page stored under key. A miss is reported
+// as redis.Nil.
+func (s *ExploreStore) Get(ctx context.Context, key string) ([]store.PostWithMetadata, error) {
+	data, err := s.rbd.Get(ctx, exploreCacheKey+key).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []store.PostWithMetadata
+	if err := json.Unmarshal(data, &posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+func (s *ExploreStore) Set(ctx context.Context, key string, posts []store.PostWithMetadata, ttl time.Duration) error {
+	data, err := json.Marshal(posts)
+	if err != nil {
+		return err
+	}
+
+	return s.rbd.SetEX(ctx, exploreCacheKey+key, data, ttl).Err()
+}
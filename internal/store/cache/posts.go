@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// PostStore caches posts as returned by store.PostStore.GetByIDs, which
+// carry no viewer specific data.
+type PostStore struct {
+	rbd *redis.Client
+}
+
+const postCacheKey = "post-%d"
+
+// Get returns the cached posts among ids, keyed by ID.
+func (s *PostStore) Get(ctx context.Context, ids []int64) (map[int64]store.PostWithMetadata, error) {
+	posts := make(map[int64]store.PostWithMetadata, len(ids))
+	if len(ids) == 0 {
+		return posts, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprintf(postCacheKey, id)
+	}
+
+	values, err := s.rbd.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		var post store.PostWithMetadata
+		if err := json.Unmarshal([]byte(data), &post); err != nil {
+			return nil, err
+		}
+		posts[post.ID] = post
+	}
+
+	return posts, nil
+}
+
+func (s *PostStore) Set(ctx context.Context, posts []store.PostWithMetadata) error {
+	_, err := s.rbd.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, post := range posts {
+			data, err := json.Marshal(post)
+			if err != nil {
+				return err
+			}
+			pipe.SetEX(ctx, fmt.Sprintf(postCacheKey, post.ID), data, time.Minute)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *PostStore) Delete(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprintf(postCacheKey, id)
+	}
+
+	return s.rbd.Del(ctx, keys...).Err()
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/Pedro-Foramilio/social/internal/store"
 	"github.com/go-redis/redis/v8"
@@ -12,10 +13,31 @@ type Storage struct {
 		Get(context.Context, int64) (*store.User, error)
 		Set(context.Context, *store.User) error
 	}
+	Explore interface {
+		Get(ctx context.Context, key string) ([]store.PostWithMetadata, error)
+		Set(ctx context.Context, key string, posts []store.PostWithMetadata, ttl time.Duration) error
+	}
+	Posts interface {
+		Get(ctx context.Context, ids []int64) (map[int64]store.PostWithMetadata, error)
+		Set(ctx context.Context, posts []store.PostWithMetadata) error
+		Delete(ctx context.Context, ids ...int64) error
+	}
+	Timelines interface {
+		Add(ctx context.Context, userIDs []int64, entry store.TimelineEntry, fresh bool) error
+		Remove(ctx context.Context, userIDs []int64, entry store.TimelineEntry) error
+		RemoveAuthor(ctx context.Context, userID, authorID int64) error
+		Invalidate(ctx context.Context, userID int64) error
+		Exists(ctx context.Context, userID int64) (bool, error)
+		Fill(ctx context.Context, userID int64, entries []store.TimelineEntry) error
+		Page(ctx context.Context, userID int64, after *store.Cursor, limit int) ([]store.TimelineEntry, error)
+	}
 }
 
 func NewRedisStorage(rbd *redis.Client) *Storage {
 	return &Storage{
-		Users: &UserStore{rbd: rbd},
+		Users:     &UserStore{rbd: rbd},
+		Explore:   &ExploreStore{rbd: rbd},
+		Posts:     &PostStore{rbd: rbd},
+		Timelines: &TimelineStore{rbd: rbd},
 	}
 }
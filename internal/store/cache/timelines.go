@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// A timeline is a sorted set of the newest entries of a user's feed, scored
+// by creation time (seconds) with "<post id>:<author id>" members. The post
+// ID is zero padded so that entries created in the same second are ordered
+// by ID, like the SQL feed.
+//
+// A timeline always holds a contiguous run of the newest entries, so readers
+// can serve its entries first and continue in SQL after the last one.
+type TimelineStore struct {
+	rbd *redis.Client
+}
+
+const (
+	timelineKey = "timeline-%d"
+	// TimelineSize caps the entries kept per timeline.
+	TimelineSize = 800
+	// timelineTTL drops the timelines of inactive users.
+	timelineTTL = 72 * time.Hour
+	// timelineBatch is the number of timelines updated per script call.
+	timelineBatch = 500
+)
+
+// addTimelineEntry adds an entry to each timeline (KEYS) unless that would
+// break its contiguity: entries older than a timeline's oldest are skipped,
+// and missing timelines are only started by fresh entries.
+// ARGV: score, member, size, ttl seconds, fresh ("1" or "0").
+var addTimelineEntry = redis.NewScript(`
+	local size = tonumber(ARGV[3])
+	for _, key in ipairs(KEYS) do
+		local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+		if (#oldest == 0 and ARGV[5] == '1') or (#oldest > 0 and tonumber(oldest[2]) <= tonumber(ARGV[1])) then
+			redis.call('ZADD', key, ARGV[1], ARGV[2])
+			redis.call('ZREMRANGEBYRANK', key, 0, -size - 1)
+			redis.call('EXPIRE', key, ARGV[4])
+		end
+	end
+	return 0
+`)
+
+func timelineMember(e store.TimelineEntry) string {
+	return fmt.Sprintf("%019d:%d", e.PostID, e.AuthorID)
+}
+
+func parseTimelineMember(z redis.Z) (store.TimelineEntry, error) {
+	member, _ := z.Member.(string)
+
+	postID, authorID, ok := strings.Cut(member, ":")
+	if !ok {
+		return store.TimelineEntry{}, fmt.Errorf("invalid timeline member %q", member)
+	}
+
+	var e store.TimelineEntry
+	var err error
+
+	if e.PostID, err = strconv.ParseInt(postID, 10, 64); err != nil {
+		return e, err
+	}
+	if e.AuthorID, err = strconv.ParseInt(authorID, 10, 64); err != nil {
+		return e, err
+	}
+	e.CreatedAt = time.Unix(int64(z.Score), 0)
+
+	return e, nil
+}
+
+// Add pushes an entry into the timelines of userIDs. Fresh entries, newer
+// than anything already published, may start timelines that do not exist.
+func (s *TimelineStore) Add(ctx context.Context, userIDs []int64, entry store.TimelineEntry, fresh bool) error {
+	freshArg := "0"
+	if fresh {
+		freshArg = "1"
+	}
+
+	for start := 0; start < len(userIDs); start += timelineBatch {
+		batch := userIDs[start:min(start+timelineBatch, len(userIDs))]
+
+		keys := make([]string, len(batch))
+		for i, id := range batch {
+			keys[i] = fmt.Sprintf(timelineKey, id)
+		}
+
+		err := addTimelineEntry.Run(ctx, s.rbd, keys,
+			entry.CreatedAt.Unix(), timelineMember(entry), TimelineSize, int(timelineTTL.Seconds()), freshArg,
+		).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remove takes an entry out of the timelines of userIDs.
+func (s *TimelineStore) Remove(ctx context.Context, userIDs []int64, entry store.TimelineEntry) error {
+	member := timelineMember(entry)
+
+	_, err := s.rbd.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range userIDs {
+			pipe.ZRem(ctx, fmt.Sprintf(timelineKey, id), member)
+		}
+		return nil
+	})
+	return err
+}
+
+// RemoveAuthor takes the entries of authorID out of the timeline of userID.
+func (s *TimelineStore) RemoveAuthor(ctx context.Context, userID, authorID int64) error {
+	key := fmt.Sprintf(timelineKey, userID)
+
+	members, err := s.rbd.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	suffix := ":" + strconv.FormatInt(authorID, 10)
+
+	var stale []any
+	for _, m := range members {
+		if strings.HasSuffix(m, suffix) {
+			stale = append(stale, m)
+		}
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+
+	return s.rbd.ZRem(ctx, key, stale...).Err()
+}
+
+// Invalidate drops the timeline of userID, to be rebuilt with Fill.
+func (s *TimelineStore) Invalidate(ctx context.Context, userID int64) error {
+	return s.rbd.Del(ctx, fmt.Sprintf(timelineKey, userID)).Err()
+}
+
+func (s *TimelineStore) Exists(ctx context.Context, userID int64) (bool, error) {
+	n, err := s.rbd.Exists(ctx, fmt.Sprintf(timelineKey, userID)).Result()
+	return n > 0, err
+}
+
+// Fill merges the newest entries of a user's feed into their timeline.
+// Entries pushed concurrently by Add are kept.
+func (s *TimelineStore) Fill(ctx context.Context, userID int64, entries []store.TimelineEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf(timelineKey, userID)
+
+	members := make([]*redis.Z, len(entries))
+	for i, e := range entries {
+		members[i] = &redis.Z{Score: float64(e.CreatedAt.Unix()), Member: timelineMember(e)}
+	}
+
+	_, err := s.rbd.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, members...)
+		pipe.ZRemRangeByRank(ctx, key, 0, -TimelineSize-1)
+		pipe.Expire(ctx, key, timelineTTL)
+		return nil
+	})
+	return err
+}
+
+// Page returns up to limit entries of the timeline of userID, newest first,
+// starting after the cursor when there is one.
+func (s *TimelineStore) Page(ctx context.Context, userID int64, after *store.Cursor, limit int) ([]store.TimelineEntry, error) {
+	key := fmt.Sprintf(timelineKey, userID)
+
+	maxScore := "+inf"
+	count := int64(limit)
+
+	if after != nil {
+		maxScore = strconv.FormatInt(after.CreatedAt.Unix(), 10)
+
+		// entries in the cursor's second up to the cursor itself are skipped
+		// below, so fetch enough to make up for them
+		ties, err := s.rbd.ZCount(ctx, key, maxScore, maxScore).Result()
+		if err != nil {
+			return nil, err
+		}
+		count += ties
+	}
+
+	members, err := s.rbd.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Max:   maxScore,
+		Min:   "-inf",
+		Count: count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]store.TimelineEntry, 0, limit)
+
+	for _, m := range members {
+		e, err := parseTimelineMember(m)
+		if err != nil {
+			return nil, err
+		}
+
+		if after != nil && e.CreatedAt.Unix() == after.CreatedAt.Unix() && e.PostID >= after.ID {
+			continue
+		}
+
+		entries = append(entries, e)
+		if len(entries) == limit {
+			break
+		}
+	}
+
+	return entries, nil
+}
@@ -3,90 +3,506 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/markup"
+)
+
+const (
+	CommentSortOldest = "oldest"
+	CommentSortNewest = "newest"
+	CommentSortTop    = "top"
+)
+
+// Comment policies decide who may comment on a post, among the users who can
+// see it. Authors may comment on their posts unless comments are locked.
+const (
+	CommentPolicyOpen      = "open"
+	CommentPolicyFollowers = "followers"
+	CommentPolicyMentioned = "mentioned"
+	CommentPolicyLocked    = "locked"
 )
 
+// commentableBy returns a SQL predicate that holds when the comment policy of
+// the post aliased as alias lets the user bound to the user placeholder
+// comment.
+func commentableBy(alias, user string) string {
+	return fmt.Sprintf(`(
+		%[1]s.comment_policy = 'open'
+		OR (%[1]s.comment_policy <> 'locked' AND %[1]s.user_id = %[2]s)
+		OR (%[1]s.comment_policy = 'followers' AND EXISTS (
+			SELECT 1 FROM followers cf WHERE cf.user_id = %[1]s.user_id AND cf.follower_id = %[2]s
+		))
+		OR (%[1]s.comment_policy = 'mentioned' AND EXISTS (
+			SELECT 1 FROM post_mentions cm WHERE cm.post_id = %[1]s.id AND cm.user_id = %[2]s
+		))
+	)`, alias, user)
+}
+
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	ID             int64          `json:"id"`
+	PostID         int64          `json:"post_id"`
+	ParentID       *int64         `json:"parent_id"`
+	Depth          int            `json:"depth"`
+	UserID         int64          `json:"user_id"`
+	Content        string         `json:"content"`
+	ContentFormat  string         `json:"content_format"`
+	ContentHTML    string         `json:"content_html"`
+	CreatedAt      string         `json:"created_at"`
+	User           User           `json:"user"`
+	ReactionCounts ReactionCounts `json:"reaction_counts"`
+	ReplyCount     int            `json:"reply_count"`
+	EditedAt       *string        `json:"edited_at"`
+	// Deleted marks a tombstone: a deleted comment kept in place because it
+	// has replies. Its content and author are not disclosed.
+	Deleted bool `json:"deleted"`
+}
+
+// score is the number of reactions to the comment, the key of the top sort.
+func (c *Comment) score() int {
+	total := 0
+	for _, n := range c.ReactionCounts {
+		total += n
+	}
+	return total
+}
+
+// CommentQuery selects one level of a comment thread: the top-level
+// comments of PostID, or the replies to ParentID when it is set. Pages
+// start after Cursor, as returned by CommentCursorFor for the same Sort.
+type CommentQuery struct {
+	PostID   int64
+	ParentID *int64
+	UserID   int64
+	Sort     string `validate:"oneof=oldest newest top"`
+	Limit    int    `validate:"gte=1,lte=100"`
+	Cursor   string
+}
+
+// CommentCursor marks a position in a comment list. Score is only used by
+// the top sort.
+type CommentCursor struct {
+	Score     int       `json:"s,omitempty"`
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+}
+
+func (c CommentCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCommentCursor(value string) (CommentCursor, error) {
+	var c CommentCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// CommentCursorFor returns the cursor positioned at comment.
+func CommentCursorFor(comment *Comment) CommentCursor {
+	createdAt, _ := time.Parse(time.RFC3339Nano, comment.CreatedAt)
+	return CommentCursor{Score: comment.score(), CreatedAt: createdAt, ID: comment.ID}
+}
+
+// commentColumns is the select list read by scanComment. It expects the
+// comment as c and its author as u.
+const commentColumns = `
+	c.id, c.post_id, c.parent_id, c.depth, c.user_id, c.content, c.content_format, c.content_html, c.created_at,
+	u.username, u.id, c.reaction_counts, c.reply_count, c.edited_at, c.deleted_at IS NOT NULL
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanComment reads a row of commentColumns, followed by the columns read
+// into extra.
+func scanComment(row rowScanner, extra ...any) (Comment, error) {
+	var c Comment
+
+	dest := []any{
+		&c.ID,
+		&c.PostID,
+		&c.ParentID,
+		&c.Depth,
+		&c.UserID,
+		&c.Content,
+		&c.ContentFormat,
+		&c.ContentHTML,
+		&c.CreatedAt,
+		&c.User.Username,
+		&c.User.ID,
+		&c.ReactionCounts,
+		&c.ReplyCount,
+		&c.EditedAt,
+		&c.Deleted,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+
+	if c.Deleted {
+		c.UserID = 0
+		c.User = User{}
+	}
+
+	return c, err
+}
+
+// commentScore is the SQL counterpart of Comment.score.
+const commentScore = `(SELECT COALESCE(SUM(value::int), 0) FROM jsonb_each_text(c.reaction_counts))`
+
+var commentOrders = map[string]string{
+	CommentSortOldest: "c.created_at ASC, c.id ASC",
+	CommentSortNewest: "c.created_at DESC, c.id DESC",
+	CommentSortTop:    commentScore + " DESC, c.created_at ASC, c.id ASC",
+}
+
+// commentAfter returns the keyset condition for the rows after a cursor in
+// the given sort, whose score, created_at and id are bound to s, t and id.
+func commentAfter(sort, s, t, id string) string {
+	switch sort {
+	case CommentSortNewest:
+		return `(c.created_at, c.id) < (` + t + `, ` + id + `)`
+	case CommentSortTop:
+		return `(` + commentScore + ` < ` + s + ` OR (` + commentScore + ` = ` + s + ` AND (c.created_at, c.id) > (` + t + `, ` + id + `)))`
+	default:
+		return `(c.created_at, c.id) > (` + t + `, ` + id + `)`
+	}
 }
 
 type CommentStore struct {
 	db *sql.DB
 }
 
-func (s *CommentStore) GetByPostId(ctx context.Context, postID int64) ([]Comment, error) {
+// GetByID returns a comment of a published, non-deleted post.
+func (s *CommentStore) GetByID(ctx context.Context, id int64) (*Comment, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id 
+		SELECT ` + commentColumns + `
 		FROM comments c
-		JOIN users ON c.user_id = users.id
-		WHERE c.post_id = $1
-		ORDER BY c.created_at DESC
+		JOIN users u ON c.user_id = u.id
+		JOIN posts p ON p.id = c.post_id
+		WHERE c.id = $1 AND p.deleted_at IS NULL AND p.status = 'published'
+	`
+
+	c, err := scanComment(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+// GetAncestorIDs returns the comments that the comment replies to, directly
+// or not.
+func (s *CommentStore) GetAncestorIDs(ctx context.Context, id int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT parent_id AS id FROM comments WHERE id = $1
+			UNION ALL
+			SELECT c.parent_id FROM comments c JOIN ancestors a ON c.id = a.id
+		)
+		SELECT id FROM ancestors WHERE id IS NOT NULL
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	comments := []Comment{}
+	ids := []int64{}
 
 	for rows.Next() {
-		var c Comment
-		c.User = User{}
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
 
-		err := rows.Scan(
-			&c.ID,
-			&c.PostID,
-			&c.UserID,
-			&c.Content,
-			&c.CreatedAt,
-			&c.User.Username,
-			&c.User.ID,
-		)
+	return ids, rows.Err()
+}
+
+// List returns one level of a comment thread, see CommentQuery.
+func (s *CommentStore) List(ctx context.Context, cq CommentQuery) ([]Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	args := []any{cq.PostID, cq.ParentID}
+
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.post_id = $1 AND c.parent_id IS NOT DISTINCT FROM $2
+	`
+
+	if cq.UserID != 0 {
+		args = append(args, cq.UserID)
+		query += ` AND c.user_id = $` + strconv.Itoa(len(args)) + ` AND c.deleted_at IS NULL`
+	}
 
+	if cq.Cursor != "" {
+		cursor, err := DecodeCommentCursor(cq.Cursor)
 		if err != nil {
 			return nil, err
 		}
+		args = append(args, cursor.Score, cursor.CreatedAt, cursor.ID)
+		n := len(args)
+		query += ` AND ` + commentAfter(cq.Sort, "$"+strconv.Itoa(n-2), "$"+strconv.Itoa(n-1), "$"+strconv.Itoa(n))
+	}
 
-		comments = append(comments, c)
+	args = append(args, cq.Limit)
+	query += `
+		ORDER BY ` + commentOrders[cq.Sort] + `
+		LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
 
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
 	}
-	return comments, nil
+
+	return comments, rows.Err()
 }
 
+// Create adds a comment, or a reply when ParentID is set. The parent must
+// belong to the same post; its reply_count is kept in sync. It fails with
+// ErrCommentsRestricted when the post's comment policy excludes the user.
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		// the post row is locked up front: its comment_count is updated
+		// below, and its policy cannot change before the comment is in
+		query := `
+			SELECT ` + commentableBy("p", "$2") + `
+			FROM posts p
+			WHERE p.id = $1 AND p.deleted_at IS NULL AND p.status = 'published'
+			AND NOT (p.repost_of_id IS NOT NULL AND NOT p.is_quote)
+			AND ` + visibleTo("p", "$2") + `
+			FOR NO KEY UPDATE OF p
+		`
+
+		var allowed bool
+		err := tx.QueryRowContext(ctx, query, comment.PostID, comment.UserID).Scan(&allowed)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if !allowed {
+			return ErrCommentsRestricted
+		}
+
+		query = `
+			INSERT INTO comments (post_id, user_id, content, content_format, content_html, parent_id, depth)
+			SELECT $1, $2, $3, $4, $5, $6,
+				COALESCE((SELECT depth + 1 FROM comments WHERE id = $6), 0)
+			WHERE ($6::bigint IS NULL OR EXISTS (
+				SELECT 1 FROM comments WHERE id = $6 AND post_id = $1 AND deleted_at IS NULL
+			))
+			RETURNING id, depth, created_at, reaction_counts
+		`
+
+		if comment.ContentFormat == "" {
+			comment.ContentFormat = markup.FormatPlain
+		}
+
+		html, err := markup.Render(comment.ContentFormat, comment.Content)
+		if err != nil {
+			return err
+		}
+		comment.ContentHTML = html
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			comment.PostID,
+			comment.UserID,
+			comment.Content,
+			comment.ContentFormat,
+			comment.ContentHTML,
+			comment.ParentID,
+		).Scan(
+			&comment.ID,
+			&comment.Depth,
+			&comment.CreatedAt,
+			&comment.ReactionCounts,
+		)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE posts SET comment_count = comment_count + 1 WHERE id = $1`, comment.PostID)
+		if err != nil {
+			return err
+		}
+
+		if comment.ParentID == nil {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE comments SET reply_count = reply_count + 1 WHERE id = $1`, *comment.ParentID)
+		return err
+	})
+}
+
+// Update rewrites the content of a comment and marks it as edited.
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	if comment.ContentFormat == "" {
+		comment.ContentFormat = markup.FormatPlain
+	}
+
+	html, err := markup.Render(comment.ContentFormat, comment.Content)
+	if err != nil {
+		return err
+	}
+	comment.ContentHTML = html
+
 	query := `
-		INSERT INTO comments (post_id, user_id, content)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at
+		UPDATE comments
+		SET content = $1, content_format = $2, content_html = $3, edited_at = NOW()
+		WHERE id = $4 AND deleted_at IS NULL
+		RETURNING edited_at
 	`
 
-	err := s.db.QueryRowContext(
+	err = s.db.QueryRowContext(
 		ctx,
 		query,
-		comment.PostID,
-		comment.UserID,
 		comment.Content,
-	).Scan(
-		&comment.ID,
-		&comment.CreatedAt,
-	)
+		comment.ContentFormat,
+		comment.ContentHTML,
+		comment.ID,
+	).Scan(&comment.EditedAt)
 
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
 	}
 
 	return nil
 }
+
+// Delete removes a comment. A comment with replies is kept as a tombstone so
+// the thread stays intact; tombstones are removed once their last reply is.
+func (s *CommentStore) Delete(ctx context.Context, id int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		var postID int64
+		var replyCount int
+		var parentID *int64
+
+		err := tx.QueryRowContext(ctx, `
+			SELECT post_id, reply_count, parent_id FROM comments
+			WHERE id = $1 AND deleted_at IS NULL
+			FOR UPDATE
+		`, id).Scan(&postID, &replyCount, &parentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE posts SET comment_count = GREATEST(comment_count - 1, 0) WHERE id = $1`, postID)
+		if err != nil {
+			return err
+		}
+
+		if replyCount > 0 {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE comments SET deleted_at = NOW(), content = '', content_html = ''
+				WHERE id = $1
+			`, id)
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM comments WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		for parentID != nil {
+			var orphaned bool
+			var grandparentID *int64
+
+			err := tx.QueryRowContext(ctx, `
+				UPDATE comments SET reply_count = reply_count - 1
+				WHERE id = $1
+				RETURNING parent_id, reply_count = 0 AND deleted_at IS NOT NULL
+			`, *parentID).Scan(&grandparentID, &orphaned)
+			if err != nil {
+				return err
+			}
+
+			if !orphaned {
+				return nil
+			}
+
+			if _, err := tx.ExecContext(ctx, `DELETE FROM comments WHERE id = $1`, *parentID); err != nil {
+				return err
+			}
+
+			parentID = grandparentID
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TimelineEntry is a feed item as kept in materialized timelines.
+type TimelineEntry struct {
+	PostID    int64
+	AuthorID  int64
+	CreatedAt time.Time
+}
+
+// GetFeedEntries returns the newest limit entries of the feed of userID, to
+// materialize it. Repost de-duplication is left to the reader.
+func (s *PostStore) GetFeedEntries(ctx context.Context, userID int64, limit int) ([]TimelineEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT p.id, p.user_id, p.created_at
+		FROM posts p
+		WHERE (p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1))
+			AND p.deleted_at IS NULL
+			AND p.status = 'published'
+			AND ` + visibleTo("p", "$1") + `
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $2
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TimelineEntry{}
+
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.PostID, &e.AuthorID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetByIDs returns the published, non-deleted posts among ids without any
+// viewer specific data, in no particular order. The result can be shared
+// between viewers and completed per viewer with HydrateFeed.
+func (s *PostStore) GetByIDs(ctx context.Context, ids []int64) ([]PostWithMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + postWithMetadataColumns + `
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN post_reactions r ON FALSE
+		LEFT JOIN bookmarks b ON FALSE
+		WHERE p.id = ANY($1) AND p.deleted_at IS NULL AND p.status = 'published'
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPostsWithMetadata(rows)
+}
+
+// HydrateFeed completes posts read with GetByIDs for viewerID: posts the
+// viewer may no longer see are dropped, and the viewer's reaction and
+// bookmark, the originals, polls and attachments are filled in.
+func (s *PostStore) HydrateFeed(ctx context.Context, viewerID int64, posts []PostWithMetadata) ([]PostWithMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if len(posts) == 0 {
+		return posts, nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+
+	query := `
+		SELECT p.id, r.type, b.post_id IS NOT NULL
+		FROM posts p
+		LEFT JOIN post_reactions r ON r.post_id = p.id AND r.user_id = $2
+		LEFT JOIN bookmarks b ON b.post_id = p.id AND b.user_id = $2
+		WHERE p.id = ANY($1) AND ` + visibleTo("p", "$2")
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type viewerData struct {
+		reaction   *string
+		bookmarked bool
+	}
+	visible := make(map[int64]viewerData, len(posts))
+
+	for rows.Next() {
+		var id int64
+		var d viewerData
+		if err := rows.Scan(&id, &d.reaction, &d.bookmarked); err != nil {
+			return nil, err
+		}
+		visible[id] = d
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hydrated := make([]PostWithMetadata, 0, len(posts))
+	for _, p := range posts {
+		d, ok := visible[p.ID]
+		if !ok {
+			continue
+		}
+		p.MyReaction = d.reaction
+		p.Bookmarked = d.bookmarked
+		hydrated = append(hydrated, p)
+	}
+
+	return hydrated, hydratePostsWithMetadata(ctx, s.db, viewerID, hydrated)
+}
@@ -52,3 +52,100 @@ func (s *FollowerStore) Unfollow(ctx context.Context, followerId int64, userID i
 func (s *FollowerStore) GetFollowers(ctx context.Context, userID int64) ([]User, error) {
 	return nil, nil
 }
+
+// GetFollowerIDs returns the IDs of up to limit followers of userID.
+func (s *FollowerStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT follower_id FROM followers WHERE user_id = $1 LIMIT $2`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetFollowerIDsAfter returns the IDs of up to limit followers of userID
+// above afterID, in ID order, to walk all the followers in batches.
+func (s *FollowerStore) GetFollowerIDsAfter(ctx context.Context, userID, afterID int64, limit int) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT follower_id FROM followers
+		WHERE user_id = $1 AND follower_id > $2
+		ORDER BY follower_id
+		LIMIT $3
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// IsConnected reports whether either user follows the other.
+func (s *FollowerStore) IsConnected(ctx context.Context, userID, otherID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		)
+	`
+
+	var connected bool
+	err := s.db.QueryRowContext(ctx, query, userID, otherID).Scan(&connected)
+	return connected, err
+}
+
+// FollowsPopular reports whether userID follows someone with more than
+// threshold followers.
+func (s *FollowerStore) FollowsPopular(ctx context.Context, userID int64, threshold int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM followers f
+			WHERE f.follower_id = $1 AND (
+				SELECT COUNT(*) FROM (
+					SELECT 1 FROM followers g WHERE g.user_id = f.user_id LIMIT $2 + 1
+				) capped
+			) > $2
+		)
+	`
+
+	var popular bool
+	err := s.db.QueryRowContext(ctx, query, userID, threshold).Scan(&popular)
+	return popular, err
+}
@@ -1,10 +1,15 @@
 package store
 
 import (
+	"errors"
+	"maps"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/markup"
 )
 
 type PaginatedFeedQuery struct {
@@ -15,63 +20,149 @@ type PaginatedFeedQuery struct {
 	Search string   `json:"search" validate:"max=100"`
 	Since  string   `json:"since"`
 	Until  string   `json:"until"`
+	Cursor string   `json:"cursor"`
+	// Position is a keyset position in the feed. It replaces Offset and is
+	// filled from a verified cursor by the caller rather than parsed.
+	Position *FeedCursor `json:"-"`
+}
+
+// Cursor marks a position in a list ordered by (created_at, id), used for
+// keyset pagination.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+}
+
+// FeedCursor is a Cursor into the feed. Prev cursors page back towards the
+// start of the feed instead of away from it.
+type FeedCursor struct {
+	Cursor
+	Prev bool `json:"p,omitempty"`
+	// Rank positions the cursor in the top feed, which is ordered by score.
+	Rank *FeedRank `json:"r,omitempty"`
+}
+
+// FeedRank is the score of the post at a top feed cursor. Every page of the
+// top feed is scored as of the same time At, so that scores stay comparable
+// across pages.
+type FeedRank struct {
+	Score float64   `json:"s"`
+	At    time.Time `json:"at"`
+}
+
+// CursorFor returns the cursor positioned at post, for lists ordered by
+// (created_at, id).
+func CursorFor(post *Post) Cursor {
+	createdAt, _ := time.Parse(time.RFC3339Nano, post.CreatedAt)
+	return Cursor{CreatedAt: createdAt, ID: post.ID}
 }
 
+// FieldErrors reports malformed query parameters, keyed by parameter.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := slices.Sorted(maps.Keys(e))
+
+	msgs := make([]string, len(fields))
+	for i, field := range fields {
+		msgs[i] = field + ": " + e[field]
+	}
+
+	return "invalid query parameters: " + strings.Join(msgs, "; ")
+}
+
+// Parse reads the query parameters of r over the defaults in fq. Malformed
+// values are reported together as FieldErrors; the ranges of well formed
+// values are left to validation.
+//
+// since and until take RFC 3339 timestamps, a date (midnight UTC) or the
+// legacy "2006-01-02 15:04:05" format (UTC), and are normalized to RFC 3339
+// in UTC.
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
 	qs := r.URL.Query()
+	errs := FieldErrors{}
+
+	for _, name := range []string{"limit", "offset", "sort", "tags", "search", "cursor", "since", "until"} {
+		if len(qs[name]) > 1 {
+			errs[name] = "must be given once"
+		}
+	}
 
-	limit := qs.Get("limit")
-	if limit == "" {
+	if limit := qs.Get("limit"); limit != "" {
 		l, err := strconv.Atoi(limit)
 		if err != nil {
-			return fq, nil
+			errs["limit"] = "must be an integer"
 		}
-
 		fq.Limit = l
 	}
 
-	offset := qs.Get("offset")
-	if offset == "" {
+	if offset := qs.Get("offset"); offset != "" {
 		o, err := strconv.Atoi(offset)
 		if err != nil {
-			return fq, nil
+			errs["offset"] = "must be an integer"
 		}
-
 		fq.Offset = o
 	}
 
-	sort := qs.Get("sort")
-	if sort == "" {
+	if sort := qs.Get("sort"); sort != "" {
 		fq.Sort = sort
 	}
 
-	tags := qs.Get("tags")
-	if tags != "" {
-		fq.Tags = strings.Split(tags, ",")
+	if tags := qs.Get("tags"); tags != "" {
+		fq.Tags = nil
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = markup.NormalizeTag(tag); tag != "" {
+				fq.Tags = append(fq.Tags, tag)
+			}
+		}
 	}
 
-	search := qs.Get("search")
-	if search != "" {
+	if search := qs.Get("search"); search != "" {
 		fq.Search = search
 	}
 
-	since := qs.Get("since")
-	if since != "" {
-		fq.Since = parseTime(since)
+	if cursor := qs.Get("cursor"); cursor != "" {
+		fq.Cursor = cursor
 	}
 
-	until := qs.Get("until")
-	if until != "" {
-		fq.Until = parseTime(until)
+	var since, until time.Time
+
+	if value := qs.Get("since"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			errs["since"] = err.Error()
+		}
+		since = t
+		fq.Since = t.Format(time.RFC3339Nano)
+	}
+
+	if value := qs.Get("until"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			errs["until"] = err.Error()
+		}
+		until = t
+		fq.Until = t.Format(time.RFC3339Nano)
+	}
+
+	if errs["since"] == "" && errs["until"] == "" && !since.IsZero() && !until.IsZero() && !since.Before(until) {
+		errs["until"] = "must be after since"
+	}
+
+	if len(errs) > 0 {
+		return fq, errs
 	}
 
 	return fq, nil
 }
 
-func parseTime(value string) string {
-	t, err := time.Parse(time.DateTime, value)
-	if err != nil {
-		return ""
+var timeLayouts = []string{time.RFC3339Nano, time.DateOnly, time.DateTime}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
 	}
-	return t.Format(time.DateTime)
+	return time.Time{}, errors.New("must be an RFC 3339 timestamp")
 }
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPaginatedFeedQueryParse(t *testing.T) {
+	defaults := PaginatedFeedQuery{Limit: 20, Offset: 0, Sort: "desc"}
+
+	with := func(edit func(fq *PaginatedFeedQuery)) PaginatedFeedQuery {
+		fq := defaults
+		edit(&fq)
+		return fq
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  PaginatedFeedQuery
+		errs  FieldErrors
+	}{
+		{
+			name:  "no parameters",
+			query: "",
+			want:  defaults,
+		},
+		{
+			name:  "limit",
+			query: "limit=50",
+			want:  with(func(fq *PaginatedFeedQuery) { fq.Limit = 50 }),
+		},
+		{
+			name:  "limit not an integer",
+			query: "limit=ten",
+			errs:  FieldErrors{"limit": "must be an integer"},
+		},
+		{
+			name:  "limit repeated",
+			query: "limit=10&limit=20",
+			errs:  FieldErrors{"limit": "must be given once"},
+		},
+		{
+			name:  "offset",
+			query: "offset=40",
+			want:  with(func(fq *PaginatedFeedQuery) { fq.Offset = 40 }),
+		},
+		{
+			name:  "offset not an integer",
+			query: "offset=1.5",
+			errs:  FieldErrors{"offset": "must be an integer"},
+		},
+		{
+			name:  "offset repeated",
+			query: "offset=0&offset=20",
+			errs:  FieldErrors{"offset": "must be given once"},
+		},
+		{
+			name:  "sort",
+			query: "sort=asc",
+			want:  with(func(fq *PaginatedFeedQuery) { fq.Sort = "asc" }),
+		},
+		{
+			name:  "sort repeated",
+			query: "sort=asc&sort=desc",
+			errs:  FieldErrors{"sort": "must be given once"},
+		},
+		{
+			name:  "tags normalized",
+			query: "tags=%23Go,,Rust",
+			want:  with(func(fq *PaginatedFeedQuery) { fq.Tags = []string{"go", "rust"} }),
+		},
+		{
+			name:  "tags repeated",
+			query: "tags=go&tags=rust",
+			errs:  FieldErrors{"tags": "must be given once"},
+		},
+		{
+			name:  "search",
+			query: "search=hello+world",
+			want:  with(func(fq *PaginatedFeedQuery) { fq.Search = "hello world" }),
+		},
+		{
+			name:  "search repeated",
+			query: "search=a&search=b",
+			errs:  FieldErrors{"search": "must be given once"},
+		},
+		{
+			name:  "cursor",
+			query: "cursor=abc",
+			want:  with(func(fq *PaginatedFeedQuery) { fq.Cursor = "abc" }),
+		},
+		{
+			name:  "cursor repeated",
+			query: "cursor=abc&cursor=def",
+			errs:  FieldErrors{"cursor": "must be given once"},
+		},
+		{
+			name:  "since as RFC 3339 normalized to UTC",
+			query: "since=2024-05-01T12:00:00%2B02:00",
+			want:  with(func(fq *PaginatedFeedQuery) { fq.Since = "2024-05-01T10:00:00Z" }),
+		},
+		{
+			name:  "since as a date",
+			query: "since=2024-05-01",
+			want:  with(func(fq *PaginatedFeedQuery) { fq.Since = "2024-05-01T00:00:00Z" }),
+		},
+		{
+			name:  "since in the legacy format",
+			query: "since=2024-05-01+08:30:00",
+			want:  with(func(fq *PaginatedFeedQuery) { fq.Since = "2024-05-01T08:30:00Z" }),
+		},
+		{
+			name:  "since malformed",
+			query: "since=yesterday",
+			errs:  FieldErrors{"since": "must be an RFC 3339 timestamp"},
+		},
+		{
+			name:  "since repeated",
+			query: "since=2024-05-01&since=2024-05-02",
+			errs:  FieldErrors{"since": "must be given once"},
+		},
+		{
+			name:  "until",
+			query: "until=2024-05-02T00:00:00.5Z",
+			want:  with(func(fq *PaginatedFeedQuery) { fq.Until = "2024-05-02T00:00:00.5Z" }),
+		},
+		{
+			name:  "until malformed",
+			query: "until=2024-13-01",
+			errs:  FieldErrors{"until": "must be an RFC 3339 timestamp"},
+		},
+		{
+			name:  "until repeated",
+			query: "until=2024-05-01&until=2024-05-02",
+			errs:  FieldErrors{"until": "must be given once"},
+		},
+		{
+			name:  "since and until",
+			query: "since=2024-05-01&until=2024-05-02",
+			want: with(func(fq *PaginatedFeedQuery) {
+				fq.Since = "2024-05-01T00:00:00Z"
+				fq.Until = "2024-05-02T00:00:00Z"
+			}),
+		},
+		{
+			name:  "until equal to since",
+			query: "since=2024-05-01&until=2024-05-01T00:00:00Z",
+			errs:  FieldErrors{"until": "must be after since"},
+		},
+		{
+			name:  "until before since",
+			query: "since=2024-05-02&until=2024-05-01",
+			errs:  FieldErrors{"until": "must be after since"},
+		},
+		{
+			name:  "every malformed parameter reported",
+			query: "limit=x&offset=y&since=z&sort=asc&sort=desc",
+			errs: FieldErrors{
+				"limit":  "must be an integer",
+				"offset": "must be an integer",
+				"since":  "must be an RFC 3339 timestamp",
+				"sort":   "must be given once",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/users/feed?"+tt.query, nil)
+
+			got, err := defaults.Parse(r)
+
+			if tt.errs != nil {
+				var fields FieldErrors
+				if !errors.As(err, &fields) {
+					t.Fatalf("Parse() error = %v, want FieldErrors", err)
+				}
+				if !reflect.DeepEqual(fields, tt.errs) {
+					t.Fatalf("Parse() field errors = %v, want %v", fields, tt.errs)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Poll is attached to a post. Vote counts are only filled in once the viewer
+// has voted or the poll is closed.
+type Poll struct {
+	MultipleChoice bool         `json:"multiple_choice"`
+	ClosesAt       string       `json:"closes_at"`
+	Closed         bool         `json:"closed"`
+	Options        []PollOption `json:"options"`
+	VoterCount     *int         `json:"voter_count,omitempty"`
+	Voted          bool         `json:"voted"`
+	MyVotes        []int64      `json:"my_votes,omitempty"`
+}
+
+type PollOption struct {
+	ID    int64  `json:"id"`
+	Text  string `json:"text"`
+	Votes *int   `json:"votes,omitempty"`
+}
+
+type PollStore struct {
+	db *sql.DB
+}
+
+// Vote records the user's ballot. Single choice polls take exactly one
+// option; a user votes only once per poll and cannot change the ballot.
+func (s *PollStore) Vote(ctx context.Context, postID, userID int64, optionIDs []int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		query := `
+			SELECT pl.multiple_choice, pl.closes_at <= NOW()
+			FROM polls pl
+			JOIN posts p ON p.id = pl.post_id
+			WHERE pl.post_id = $1 AND p.deleted_at IS NULL AND p.status = 'published'
+			FOR UPDATE OF pl
+		`
+
+		var multipleChoice, closed bool
+		err := tx.QueryRowContext(ctx, query, postID).Scan(&multipleChoice, &closed)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if closed {
+			return ErrPollClosed
+		}
+
+		if len(optionIDs) == 0 || (!multipleChoice && len(optionIDs) > 1) {
+			return ErrInvalidVote
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO poll_voters (post_id, user_id) VALUES ($1, $2)`, postID, userID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrAlredyExists
+			}
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			UPDATE poll_options SET vote_count = vote_count + 1
+			WHERE post_id = $1 AND id = ANY($2)
+		`, postID, pq.Array(optionIDs))
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected != int64(len(optionIDs)) {
+			return ErrInvalidVote
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO poll_votes (option_id, user_id)
+			SELECT unnest($1::bigint[]), $2
+		`, pq.Array(optionIDs), userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE polls SET voter_count = voter_count + 1 WHERE post_id = $1`, postID)
+		return err
+	})
+}
+
+func createPoll(ctx context.Context, tx *sql.Tx, postID int64, poll *Poll) error {
+	query := `
+		INSERT INTO polls (post_id, multiple_choice, closes_at)
+		VALUES ($1, $2, $3)
+		RETURNING closes_at
+	`
+
+	err := tx.QueryRowContext(ctx, query, postID, poll.MultipleChoice, poll.ClosesAt).Scan(&poll.ClosesAt)
+	if err != nil {
+		return err
+	}
+
+	for i := range poll.Options {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO poll_options (post_id, position, text)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, postID, i, poll.Options[i].Text).Scan(&poll.Options[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attachPolls loads the polls of posts and fills in the results the viewer
+// is allowed to see.
+func attachPolls(ctx context.Context, db *sql.DB, viewerID int64, posts []*Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	query := `
+		SELECT pl.post_id, pl.multiple_choice, pl.closes_at, pl.closes_at <= NOW(), pl.voter_count,
+		EXISTS (SELECT 1 FROM poll_voters v WHERE v.post_id = pl.post_id AND v.user_id = $2)
+		FROM polls pl
+		WHERE pl.post_id = ANY($1)
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids), viewerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	polls := make(map[int64]*Poll)
+	voterCounts := make(map[int64]int)
+
+	for rows.Next() {
+		var postID int64
+		var voterCount int
+		poll := &Poll{}
+		err := rows.Scan(&postID, &poll.MultipleChoice, &poll.ClosesAt, &poll.Closed, &voterCount, &poll.Voted)
+		if err != nil {
+			return err
+		}
+		polls[postID] = poll
+		voterCounts[postID] = voterCount
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(polls) == 0 {
+		return nil
+	}
+
+	query = `
+		SELECT o.post_id, o.id, o.text, o.vote_count,
+		EXISTS (SELECT 1 FROM poll_votes v WHERE v.option_id = o.id AND v.user_id = $2)
+		FROM poll_options o
+		WHERE o.post_id = ANY($1)
+		ORDER BY o.post_id, o.position
+	`
+
+	rows, err = db.QueryContext(ctx, query, pq.Array(ids), viewerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int64
+		var option PollOption
+		var votes int
+		var mine bool
+		if err := rows.Scan(&postID, &option.ID, &option.Text, &votes, &mine); err != nil {
+			return err
+		}
+
+		poll := polls[postID]
+		if poll.Voted || poll.Closed {
+			option.Votes = &votes
+		}
+		if mine {
+			poll.MyVotes = append(poll.MyVotes, option.ID)
+		}
+		poll.Options = append(poll.Options, option)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for postID, poll := range polls {
+		if poll.Voted || poll.Closed {
+			count := voterCounts[postID]
+			poll.VoterCount = &count
+		}
+	}
+
+	for _, p := range posts {
+		p.Poll = polls[p.ID]
+	}
+
+	return nil
+}
@@ -4,27 +4,150 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
 	"time"
 
+	"github.com/Pedro-Foramilio/social/internal/markup"
 	"github.com/lib/pq"
 )
 
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Version   int       `json:"version"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	ID             int64          `json:"id"`
+	Content        string         `json:"content"`
+	ContentFormat  string         `json:"content_format"`
+	ContentHTML    string         `json:"content_html"`
+	Title          string         `json:"title"`
+	UserID         int64          `json:"user_id"`
+	Tags           []string       `json:"tags"`
+	CreatedAt      string         `json:"created_at"`
+	UpdatedAt      string         `json:"updated_at"`
+	Version        int            `json:"version"`
+	Status         string         `json:"status"`
+	Visibility     string         `json:"visibility"`
+	CommentPolicy  string         `json:"comment_policy"`
+	Language       string         `json:"language"`
+	PublishAt      *string        `json:"publish_at,omitempty"`
+	PinnedAt       *string        `json:"pinned_at,omitempty"`
+	DeletedAt      *string        `json:"deleted_at,omitempty"`
+	DeletedBy      *int64         `json:"deleted_by,omitempty"`
+	Comments       []Comment      `json:"comments,omitempty"`
+	ReactionCounts ReactionCounts `json:"reaction_counts"`
+	MyReaction     *string        `json:"my_reaction,omitempty"`
+	Bookmarked     bool           `json:"bookmarked"`
+	RepostOfID     *int64         `json:"repost_of_id,omitempty"`
+	IsQuote        bool           `json:"is_quote"`
+	RepostCount    int            `json:"repost_count"`
+	CommentCount   int            `json:"comment_count"`
+	Original       *Post          `json:"original,omitempty"`
+	Attachments    []Attachment   `json:"attachments"`
+	Poll           *Poll          `json:"poll,omitempty"`
+	User           User           `json:"user"`
+}
+
+// renderContent fills ContentHTML from Content, so the stored HTML always
+// matches the stored source.
+func (p *Post) renderContent() error {
+	if p.ContentFormat == "" {
+		p.ContentFormat = markup.FormatPlain
+	}
+
+	html, err := markup.Render(p.ContentFormat, p.Content)
+	if err != nil {
+		return err
+	}
+
+	p.ContentHTML = html
+	return nil
+}
+
+// IsPlainRepost reports whether the post is a repost without commentary.
+func (p *Post) IsPlainRepost() bool {
+	return p.RepostOfID != nil && !p.IsQuote
 }
 
 type PostWithMetadata struct {
 	Post
-	CommentCount int `json:"comment_count"`
+	// Score is the rank of the post in the top feed.
+	Score *float64 `json:"score,omitempty"`
+}
+
+// postWithMetadataColumns is the select list read by scanPostsWithMetadata.
+// It expects the post as p, its author as u, and the viewer's reaction and
+// bookmark as r and b.
+const postWithMetadataColumns = `
+	p.id, p.user_id, p.title, p.content, p.content_format, p.content_html, p.created_at, p.version, p.tags,
+	u.username,
+	p.comment_count,
+	p.reaction_counts, r.type,
+	b.post_id IS NOT NULL AS bookmarked,
+	p.repost_of_id, p.is_quote, p.repost_count, p.visibility, p.comment_policy, p.language, p.pinned_at
+`
+
+func scanPostsWithMetadata(rows *sql.Rows) ([]PostWithMetadata, error) {
+	posts := []PostWithMetadata{}
+
+	for rows.Next() {
+		post, err := scanPostWithMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// scanPostWithMetadata reads a row of postWithMetadataColumns, followed by
+// the columns read into extra.
+func scanPostWithMetadata(row rowScanner, extra ...any) (PostWithMetadata, error) {
+	var post PostWithMetadata
+
+	dest := []any{
+		&post.ID,
+		&post.UserID,
+		&post.Title,
+		&post.Content,
+		&post.ContentFormat,
+		&post.ContentHTML,
+		&post.CreatedAt,
+		&post.Version,
+		pq.Array(&post.Tags),
+		&post.User.Username,
+		&post.CommentCount,
+		&post.ReactionCounts,
+		&post.MyReaction,
+		&post.Bookmarked,
+		&post.RepostOfID,
+		&post.IsQuote,
+		&post.RepostCount,
+		&post.Visibility,
+		&post.CommentPolicy,
+		&post.Language,
+		&post.PinnedAt,
+	}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return post, err
+	}
+	post.User.ID = post.UserID
+	post.Status = PostStatusPublished
+
+	return post, nil
+}
+
+func hydratePostsWithMetadata(ctx context.Context, db *sql.DB, viewerID int64, posts []PostWithMetadata) error {
+	refs := make([]*Post, len(posts))
+	for i := range posts {
+		refs[i] = &posts[i].Post
+	}
+
+	return hydratePosts(ctx, db, viewerID, refs)
 }
 
 type PostStore struct {
@@ -32,33 +155,129 @@ type PostStore struct {
 }
 
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		query := `
+			INSERT INTO posts (content, title, user_id, tags, status, publish_at, repost_of_id, is_quote,
+				content_format, content_html, visibility, comment_policy, language)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id, created_at, updated_at, version, reaction_counts
+		`
+
+		if post.Status == "" {
+			post.Status = PostStatusPublished
+		}
+
+		if post.Visibility == "" {
+			post.Visibility = VisibilityPublic
+		}
+
+		if post.CommentPolicy == "" {
+			post.CommentPolicy = CommentPolicyOpen
+		}
+
+		if post.Language == "" {
+			post.Language = DefaultLanguage
+		}
+
+		if err := post.renderContent(); err != nil {
+			return err
+		}
+		post.Tags = markup.MergeTags(post.Tags, post.Content)
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Content,
+			post.Title,
+			post.UserID,
+			pq.Array(post.Tags),
+			post.Status,
+			post.PublishAt,
+			post.RepostOfID,
+			post.IsQuote,
+			post.ContentFormat,
+			post.ContentHTML,
+			post.Visibility,
+			post.CommentPolicy,
+			post.Language,
+		).Scan(
+			&post.ID,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Version,
+			&post.ReactionCounts,
+		)
+
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrAlredyExists
+			}
+			return err
+		}
+
+		if err := saveMentions(ctx, tx, post.ID, post.Content); err != nil {
+			return err
+		}
+
+		if err := recordTagUsage(ctx, tx, []int64{post.ID}, 1); err != nil {
+			return err
+		}
+
+		if post.Poll != nil {
+			if err := createPoll(ctx, tx, post.ID, post.Poll); err != nil {
+				return err
+			}
+		}
+
+		if len(post.Attachments) > 0 {
+			ids := make([]int64, len(post.Attachments))
+			for i, a := range post.Attachments {
+				ids[i] = a.ID
+			}
+
+			if err := linkAttachments(ctx, tx, post.ID, post.UserID, ids); err != nil {
+				return err
+			}
+		}
+
+		if post.RepostOfID != nil {
+			return adjustRepostCount(ctx, tx, *post.RepostOfID, 1)
+		}
+
+		return nil
+	})
+}
+
+// Hydrate loads the data that lives outside the posts row: the original of
+// reposts, as far as viewerID may see it, the attachments and the polls.
+func (s *PostStore) Hydrate(ctx context.Context, viewerID int64, posts ...*Post) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	query := `
-		INSERT INTO posts (content, title, user_id, tags)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, updated_at
-	`
+	return hydratePosts(ctx, s.db, viewerID, posts)
+}
 
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		post.Content,
-		post.Title,
-		post.UserID,
-		pq.Array(post.Tags),
-	).Scan(
-		&post.ID,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	)
+func hydratePosts(ctx context.Context, db *sql.DB, viewerID int64, posts []*Post) error {
+	if err := attachOriginals(ctx, db, viewerID, posts); err != nil {
+		return err
+	}
 
-	if err != nil {
+	// polls are shown on embedded originals too
+	withOriginals := slices.Clone(posts)
+	for _, p := range posts {
+		if p.Original != nil {
+			withOriginals = append(withOriginals, p.Original)
+		}
+	}
+
+	if err := attachPolls(ctx, db, viewerID, withOriginals); err != nil {
 		return err
 	}
 
-	return nil
+	return attachAttachments(ctx, db, posts)
 }
 
 func (s *PostStore) GetByID(ctx context.Context, idStr int64) (*Post, error) {
@@ -66,9 +285,10 @@ func (s *PostStore) GetByID(ctx context.Context, idStr int64) (*Post, error) {
 	defer cancel()
 
 	query := `
-		SELECT id, content, title, user_id, tags, created_at, updated_at, version
+		SELECT id, content, content_format, content_html, title, user_id, tags, created_at, updated_at, version, status, publish_at, reaction_counts,
+		repost_of_id, is_quote, repost_count, visibility, comment_policy, language, pinned_at, comment_count
 		FROM posts
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	var post Post
@@ -76,12 +296,25 @@ func (s *PostStore) GetByID(ctx context.Context, idStr int64) (*Post, error) {
 	err := s.db.QueryRowContext(ctx, query, idStr).Scan(
 		&post.ID,
 		&post.Content,
+		&post.ContentFormat,
+		&post.ContentHTML,
 		&post.Title,
 		&post.UserID,
 		pq.Array(&post.Tags),
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		&post.Version,
+		&post.Status,
+		&post.PublishAt,
+		&post.ReactionCounts,
+		&post.RepostOfID,
+		&post.IsQuote,
+		&post.RepostCount,
+		&post.Visibility,
+		&post.CommentPolicy,
+		&post.Language,
+		&post.PinnedAt,
+		&post.CommentCount,
 	)
 
 	if err != nil {
@@ -98,125 +331,325 @@ func (s *PostStore) GetByID(ctx context.Context, idStr int64) (*Post, error) {
 
 }
 
-func (s *PostStore) Delete(ctx context.Context, id int64) error {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+// Delete moves a post to the trash. A non-zero version must match the
+// post's current version, or ErrConflict is returned.
+func (s *PostStore) Delete(ctx context.Context, id int64, deletedBy int64, version int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
 
-	query := `
-		DELETE FROM posts
-		WHERE id = $1
-	`
-	res, err := s.db.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
+		if err := recordTagUsage(ctx, tx, []int64{id}, -1); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE posts
+			SET deleted_at = NOW(), deleted_by = $2
+			WHERE id = $1 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)
+			RETURNING repost_of_id
+		`
+
+		var repostOfID *int64
+		err := tx.QueryRowContext(ctx, query, id, deletedBy, version).Scan(&repostOfID)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			var exists bool
+			err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL)`, id).Scan(&exists)
+			switch {
+			case err != nil:
+				return err
+			case exists:
+				return ErrConflict
+			default:
+				return ErrNotFound
+			}
+		}
+
+		if repostOfID != nil {
+			return adjustRepostCount(ctx, tx, *repostOfID, -1)
+		}
+
+		return nil
+	})
+}
+
+func (s *PostStore) Update(ctx context.Context, post *Post) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		// created_at is moved to the publication time when a draft or
+		// scheduled post goes live, so it lands at the top of feeds.
+		query := `
+			UPDATE posts
+			SET title = $1, content = $2, tags = $3, status = $6, publish_at = $7,
+				content_format = $8, content_html = $9, visibility = $10, comment_policy = $11,
+				language = $12,
+				created_at = CASE WHEN status <> 'published' AND $6 = 'published' THEN NOW() ELSE created_at END,
+				updated_at = NOW(), version = version + 1
+			WHERE id = $4 AND version = $5 AND deleted_at IS NULL
+			RETURNING version, created_at
+		`
+
+		if err := post.renderContent(); err != nil {
+			return err
+		}
+		post.Tags = markup.MergeTags(post.Tags, post.Content)
+
+		// the usage of the previous tags is taken back and recorded again
+		// below with the new tags, status and created_at
+		if err := recordTagUsage(ctx, tx, []int64{post.ID}, -1); err != nil {
+			return err
+		}
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Title,
+			post.Content,
+			pq.Array(post.Tags),
+			post.ID,
+			post.Version,
+			post.Status,
+			post.PublishAt,
+			post.ContentFormat,
+			post.ContentHTML,
+			post.Visibility,
+			post.CommentPolicy,
+			post.Language,
+		).Scan(&post.Version, &post.CreatedAt)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrConflict
+			default:
+				return err
+			}
+		}
+
+		if err := saveMentions(ctx, tx, post.ID, post.Content); err != nil {
+			return err
+		}
+
+		return recordTagUsage(ctx, tx, []int64{post.ID}, 1)
+	})
+}
+
+// GetUserFeed returns the posts and reposts of userID and of the users they
+// follow. Pages start at fq.Position, or at fq.Offset when there is none.
+func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	if fq.Position != nil && fq.Position.Rank != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	q := newTimelineQuery(userID, fq)
+	q.where(feedAuthors)
+
+	if fq.Position != nil {
+		q.after(fq.Position)
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	posts, err := s.queryTimeline(ctx, q)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if rowsAffected == 0 {
-		return ErrNotFound
+	if fq.Position != nil && fq.Position.Prev {
+		slices.Reverse(posts)
 	}
 
-	return nil
+	return posts, nil
 }
 
-func (s *PostStore) Update(ctx context.Context, post *Post) error {
+// GetTopFeed returns the feed of userID ranked by score as of at, highest
+// first. Pages start at fq.Position, which must be a top feed cursor, or at
+// fq.Offset when there is none.
+func (s *PostStore) GetTopFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery, r FeedRanking, at time.Time) ([]PostWithMetadata, error) {
+	if fq.Position != nil && (fq.Position.Rank == nil || fq.Position.Prev) {
+		return nil, ErrInvalidCursor
+	}
+
+	q := newTimelineQuery(userID, fq)
+	q.where(feedAuthors)
+	q.rank(r, at, fq.Position)
+
+	return s.queryTimeline(ctx, q)
+}
+
+// feedAuthors restricts a timeline to the posts of the viewer and of the
+// users they follow.
+const feedAuthors = `(p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1))`
 
+func (s *PostStore) GetTrash(ctx context.Context, userID int64, deletedSince time.Time) ([]Post, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	query := `
-		UPDATE posts
-		SET title = $1, content = $2, tags = $3, updated_at = NOW(), version = version + 1
-		WHERE id = $4 AND version = $5
-		RETURNING version
+		SELECT id, content, content_format, content_html, title, user_id, tags, created_at, updated_at, version, status, publish_at, visibility, deleted_at, deleted_by
+		FROM posts
+		WHERE user_id = $1 AND deleted_at IS NOT NULL AND deleted_at > $2
+		ORDER BY deleted_at DESC
 	`
 
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		post.Title,
-		post.Content,
-		pq.Array(post.Tags),
-		post.ID,
-		post.Version,
-	).Scan(&post.Version)
-
+	rows, err := s.db.QueryContext(ctx, query, userID, deletedSince)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
-			return err
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+
+	for rows.Next() {
+		var post Post
+		err := rows.Scan(
+			&post.ID,
+			&post.Content,
+			&post.ContentFormat,
+			&post.ContentHTML,
+			&post.Title,
+			&post.UserID,
+			pq.Array(&post.Tags),
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Version,
+			&post.Status,
+			&post.PublishAt,
+			&post.Visibility,
+			&post.DeletedAt,
+			&post.DeletedBy,
+		)
+		if err != nil {
+			return nil, err
 		}
+		posts = append(posts, post)
 	}
 
-	return nil
+	return posts, rows.Err()
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+func (s *PostStore) Restore(ctx context.Context, id int64, userID int64, deletedSince time.Time) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		query := `
+			UPDATE posts
+			SET deleted_at = NULL, deleted_by = NULL
+			WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL AND deleted_at > $3
+			RETURNING repost_of_id
+		`
 
-	shouldFilterByTags := len(fq.Tags) > 0
+		var repostOfID *int64
+		err := tx.QueryRowContext(ctx, query, id, userID, deletedSince).Scan(&repostOfID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrAlredyExists
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
 
-	query := `
-		SELECT p.id, p.user_id, p.title, p.created_at, p.version, p.tags,
-		u.username,
-		COUNT(c.id) AS comments_count
-		FROM posts p
-		LEFT JOIN comments c ON p.id = c.post_id
-		LEFT JOIN users u ON u.id = p.user_id
-		JOIN followers f on f.follower_id = p.user_id OR p.user_id = $1
-		WHERE 
-			(f.user_id = $1)
-			AND
-			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
-	`
+		if err := recordTagUsage(ctx, tx, []int64{id}, 1); err != nil {
+			return err
+		}
 
-	if shouldFilterByTags {
-		query += `
-			AND (p.tags @> $5)
-		`
-	}
+		if repostOfID != nil {
+			return adjustRepostCount(ctx, tx, *repostOfID, 1)
+		}
 
-	query += `
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + `
-		LIMIT $2 OFFSET $3
-	`
+		return nil
+	})
+}
 
-	var rows *sql.Rows
-	var err error
-	if shouldFilterByTags {
-		rows, err = s.db.QueryContext(ctx, query,
-			userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
-	} else {
-		rows, err = s.db.QueryContext(ctx, query,
-			userID, fq.Limit, fq.Offset, fq.Search)
-	}
+// PurgeDeleted hard-deletes posts soft-deleted before the given time,
+// together with their comments and plain reposts, and returns the number of
+// posts removed.
+func (s *PostStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM comments
+			WHERE post_id IN (
+				SELECT id FROM posts WHERE deleted_at IS NOT NULL AND deleted_at <= $1
+			)
+		`, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		// plain reposts would otherwise be left pointing at nothing
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM posts
+			WHERE NOT is_quote AND repost_of_id IN (
+				SELECT id FROM posts WHERE deleted_at IS NOT NULL AND deleted_at <= $1
+			)
+		`, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			DELETE FROM posts
+			WHERE deleted_at IS NOT NULL AND deleted_at <= $1
+		`, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		purged, err = res.RowsAffected()
+		return err
+	})
+
+	return purged, err
+}
+
+func (s *PostStore) GetByStatus(ctx context.Context, userID int64, status string) ([]Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT id, content, content_format, content_html, title, user_id, tags, created_at, updated_at, version, status, publish_at, visibility, comment_policy, language
+		FROM posts
+		WHERE user_id = $1 AND status = $2 AND deleted_at IS NULL
+		ORDER BY publish_at ASC NULLS LAST, updated_at DESC
+	`
 
+	rows, err := s.db.QueryContext(ctx, query, userID, status)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var posts []PostWithMetadata
+	posts := []Post{}
 
 	for rows.Next() {
-		var post PostWithMetadata
+		var post Post
 		err := rows.Scan(
 			&post.ID,
-			&post.UserID,
+			&post.Content,
+			&post.ContentFormat,
+			&post.ContentHTML,
 			&post.Title,
+			&post.UserID,
+			pq.Array(&post.Tags),
 			&post.CreatedAt,
+			&post.UpdatedAt,
 			&post.Version,
-			pq.Array(&post.Tags),
-			&post.User.Username,
-			&post.CommentCount,
+			&post.Status,
+			&post.PublishAt,
+			&post.Visibility,
+			&post.CommentPolicy,
+			&post.Language,
 		)
 		if err != nil {
 			return nil, err
@@ -224,5 +657,56 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 		posts = append(posts, post)
 	}
 
-	return posts, nil
+	return posts, rows.Err()
+}
+
+// PublishScheduled publishes up to limit scheduled posts whose publish_at has
+// passed and returns their IDs. Rows are claimed with SKIP LOCKED so several
+// API instances can run the publisher concurrently.
+func (s *PostStore) PublishScheduled(ctx context.Context, limit int) ([]int64, error) {
+	var ids []int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		query := `
+			UPDATE posts
+			SET status = 'published', created_at = NOW(), updated_at = NOW(), version = version + 1
+			WHERE id IN (
+				SELECT id FROM posts
+				WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+				ORDER BY publish_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id
+		`
+
+		rows, err := tx.QueryContext(ctx, query, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		return recordTagUsage(ctx, tx, ids, 1)
+	})
+
+	return ids, err
 }
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ReactionCounts holds the number of reactions per type, as stored in the
+// reaction_counts JSONB column of posts and comments.
+type ReactionCounts map[string]int
+
+func (rc *ReactionCounts) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*rc = ReactionCounts{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into ReactionCounts", src)
+	}
+
+	counts := ReactionCounts{}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return err
+	}
+	*rc = counts
+	return nil
+}
+
+type reactionTarget struct {
+	table       string
+	column      string
+	parentTable string
+	// lockQuery locks the reacted row ($1) and fails with no rows when it is
+	// missing or hidden from the reacting user ($2).
+	lockQuery string
+}
+
+var (
+	postReactions = reactionTarget{
+		table:       "post_reactions",
+		column:      "post_id",
+		parentTable: "posts",
+		lockQuery: `
+			SELECT p.id FROM posts p
+			WHERE p.id = $1 AND p.deleted_at IS NULL AND p.status = 'published'
+				AND ` + visibleTo("p", "$2") + `
+			FOR UPDATE OF p
+		`,
+	}
+	commentReactions = reactionTarget{
+		table:       "comment_reactions",
+		column:      "comment_id",
+		parentTable: "comments",
+		lockQuery: `
+			SELECT c.id FROM comments c
+			JOIN posts p ON p.id = c.post_id
+			WHERE c.id = $1 AND c.deleted_at IS NULL AND p.deleted_at IS NULL
+				AND ` + visibleTo("p", "$2") + `
+			FOR UPDATE OF c
+		`,
+	}
+)
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+func (s *ReactionStore) SetPostReaction(ctx context.Context, postID, userID int64, reaction string) (bool, error) {
+	return s.set(ctx, postReactions, postID, userID, reaction)
+}
+
+func (s *ReactionStore) RemovePostReaction(ctx context.Context, postID, userID int64) error {
+	return s.remove(ctx, postReactions, postID, userID)
+}
+
+func (s *ReactionStore) GetPostReaction(ctx context.Context, postID, userID int64) (string, error) {
+	return s.get(ctx, postReactions, postID, userID)
+}
+
+func (s *ReactionStore) SetCommentReaction(ctx context.Context, commentID, userID int64, reaction string) (bool, error) {
+	return s.set(ctx, commentReactions, commentID, userID, reaction)
+}
+
+func (s *ReactionStore) RemoveCommentReaction(ctx context.Context, commentID, userID int64) error {
+	return s.remove(ctx, commentReactions, commentID, userID)
+}
+
+// set stores the user's reaction, replacing any previous one, and keeps the
+// parent's reaction_counts in sync within the same transaction. It reports
+// false when the user already had that reaction.
+func (s *ReactionStore) set(ctx context.Context, target reactionTarget, id, userID int64, reaction string) (bool, error) {
+	var changed bool
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		if err := s.lock(ctx, tx, target, id, userID); err != nil {
+			return err
+		}
+
+		var previous string
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(
+			`SELECT type FROM %s WHERE %s = $1 AND user_id = $2`,
+			target.table, target.column,
+		), id, userID).Scan(&previous)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if previous == reaction {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO %s (%s, user_id, type)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (%s, user_id) DO UPDATE SET type = EXCLUDED.type, created_at = NOW()
+		`, target.table, target.column, target.column), id, userID, reaction)
+		if err != nil {
+			return err
+		}
+
+		if previous != "" {
+			if err := s.adjustCount(ctx, tx, target, id, previous, -1); err != nil {
+				return err
+			}
+		}
+
+		changed = true
+		return s.adjustCount(ctx, tx, target, id, reaction, 1)
+	})
+
+	return changed, err
+}
+
+// remove deletes the user's reaction if there is one. Removing a reaction
+// that does not exist is not an error.
+func (s *ReactionStore) remove(ctx context.Context, target reactionTarget, id, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		if err := s.lock(ctx, tx, target, id, userID); err != nil {
+			return err
+		}
+
+		var previous string
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(
+			`DELETE FROM %s WHERE %s = $1 AND user_id = $2 RETURNING type`,
+			target.table, target.column,
+		), id, userID).Scan(&previous)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+
+		return s.adjustCount(ctx, tx, target, id, previous, -1)
+	})
+}
+
+func (s *ReactionStore) get(ctx context.Context, target reactionTarget, id, userID int64) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var reaction string
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(
+		`SELECT type FROM %s WHERE %s = $1 AND user_id = $2`,
+		target.table, target.column,
+	), id, userID).Scan(&reaction)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return reaction, nil
+}
+
+func (s *ReactionStore) lock(ctx context.Context, tx *sql.Tx, target reactionTarget, id, userID int64) error {
+	var lockedID int64
+	err := tx.QueryRowContext(ctx, target.lockQuery, id, userID).Scan(&lockedID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// adjustCount adds delta to one reaction type in reaction_counts, dropping
+// the key when it reaches zero.
+func (s *ReactionStore) adjustCount(ctx context.Context, tx *sql.Tx, target reactionTarget, id int64, reaction string, delta int) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET reaction_counts = jsonb_strip_nulls(
+			reaction_counts || jsonb_build_object(
+				$2::text, NULLIF(COALESCE((reaction_counts->>$2)::int, 0) + $3, 0)
+			)
+		)
+		WHERE id = $1
+	`, target.parentTable)
+
+	_, err := tx.ExecContext(ctx, query, id, reaction, delta)
+	return err
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DeleteRepost removes the user's plain repost of originalID and returns it
+// (id, user_id and created_at), so that it can be taken out of timelines.
+// Plain reposts carry no content of their own, so they are deleted right
+// away instead of going through the trash.
+func (s *PostStore) DeleteRepost(ctx context.Context, userID, originalID int64) (*Post, error) {
+	repost := &Post{}
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		query := `
+			DELETE FROM posts
+			WHERE user_id = $1 AND repost_of_id = $2 AND NOT is_quote AND deleted_at IS NULL
+			RETURNING id, user_id, created_at
+		`
+
+		err := tx.QueryRowContext(ctx, query, userID, originalID).Scan(&repost.ID, &repost.UserID, &repost.CreatedAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		return adjustRepostCount(ctx, tx, originalID, -1)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repost, nil
+}
+
+// attachOriginals loads the original post of every repost in posts. Originals
+// that were deleted, are not published or are hidden from viewerID are left
+// out.
+func attachOriginals(ctx context.Context, db *sql.DB, viewerID int64, posts []*Post) error {
+	var ids []int64
+	for _, p := range posts {
+		if p.RepostOfID != nil {
+			ids = append(ids, *p.RepostOfID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `
+		SELECT p.id, p.user_id, u.username, p.title, p.content, p.content_format, p.content_html, p.tags, p.created_at,
+		p.reaction_counts, p.repost_count, p.comment_count, p.visibility
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.id = ANY($1) AND p.deleted_at IS NULL AND p.status = 'published'
+			AND ` + visibleTo("p", "$2") + `
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids), viewerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	originals := make(map[int64]*Post, len(ids))
+	for rows.Next() {
+		var o Post
+		err := rows.Scan(
+			&o.ID,
+			&o.UserID,
+			&o.User.Username,
+			&o.Title,
+			&o.Content,
+			&o.ContentFormat,
+			&o.ContentHTML,
+			pq.Array(&o.Tags),
+			&o.CreatedAt,
+			&o.ReactionCounts,
+			&o.RepostCount,
+			&o.CommentCount,
+			&o.Visibility,
+		)
+		if err != nil {
+			return err
+		}
+		o.User.ID = o.UserID
+		o.Status = PostStatusPublished
+		originals[o.ID] = &o
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		if p.RepostOfID != nil {
+			p.Original = originals[*p.RepostOfID]
+		}
+	}
+
+	return nil
+}
+
+func adjustRepostCount(ctx context.Context, tx *sql.Tx, postID int64, delta int) error {
+	query := `UPDATE posts SET repost_count = GREATEST(repost_count + $2, 0) WHERE id = $1`
+
+	_, err := tx.ExecContext(ctx, query, postID, delta)
+	return err
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"strings"
+	"time"
+)
+
+// DefaultLanguage is the text search configuration of posts created without
+// a language, and of search queries that don't name one.
+const DefaultLanguage = "english"
+
+const (
+	SearchPosts    = "posts"
+	SearchComments = "comments"
+	SearchUsers    = "users"
+)
+
+// SearchQuery is a full text search. Query uses the websearch_to_tsquery
+// syntax ("quoted phrases", or, -excluded) and is stemmed with Language.
+type SearchQuery struct {
+	Query    string   `validate:"required,max=200"`
+	Types    []string `validate:"dive,oneof=posts comments users"`
+	Language string   `validate:"oneof=simple danish dutch english finnish french german hungarian italian norwegian portuguese romanian russian spanish swedish turkish"`
+	Limit    int      `validate:"gte=1,lte=50"`
+	Offset   int      `validate:"gte=0"`
+}
+
+// PostSearchResult is a post matching a search, with its title and an
+// excerpt of its content highlighted.
+type PostSearchResult struct {
+	PostWithMetadata
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+type CommentSearchResult struct {
+	Comment
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type UserSearchResult struct {
+	ID       int64   `json:"id"`
+	Username string  `json:"username"`
+	Rank     float64 `json:"rank"`
+}
+
+// Highlights are delimited with private use characters, so that the text
+// around them can be escaped before they are turned into <mark> tags.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+const (
+	titleHighlightOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+	snippetOptions        = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxFragments=2, MaxWords=30, MinWords=10"
+)
+
+var highlightReplacer = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// highlight returns the output of ts_headline as HTML.
+func highlight(text string) string {
+	return highlightReplacer.Replace(html.EscapeString(text))
+}
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+// Posts returns the published posts matching sq that viewerID may see, most
+// relevant first. Titles weigh more than content, and content more than
+// tags. viewerID may be 0 for anonymous requests.
+func (s *SearchStore) Posts(ctx context.Context, viewerID int64, sq SearchQuery) ([]PostSearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + postWithMetadataColumns + `,
+			ts_rank_cd(p.search_vector, q) AS rank,
+			ts_headline(p.language, p.title, q, $5),
+			ts_headline(p.language, p.content, q, $6)
+		FROM posts p
+		CROSS JOIN websearch_to_tsquery($2::regconfig, $3) q
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN post_reactions r ON r.post_id = p.id AND r.user_id = $1
+		LEFT JOIN bookmarks b ON b.post_id = p.id AND b.user_id = $1
+		WHERE p.search_vector @@ q
+			AND p.deleted_at IS NULL
+			AND p.status = 'published'
+			AND NOT (p.repost_of_id IS NOT NULL AND NOT p.is_quote)
+			AND ` + visibleTo("p", "$1") + `
+		ORDER BY rank DESC, p.id DESC
+		LIMIT $4 OFFSET $7
+	`
+
+	rows, err := s.db.QueryContext(ctx, query,
+		viewerID, sq.Language, sq.Query, sq.Limit, titleHighlightOptions, snippetOptions, sq.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []PostSearchResult{}
+
+	for rows.Next() {
+		var res PostSearchResult
+		res.PostWithMetadata, err = scanPostWithMetadata(rows, &res.Rank, &res.TitleHighlight, &res.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		res.TitleHighlight = highlight(res.TitleHighlight)
+		res.Snippet = highlight(res.Snippet)
+		results = append(results, res)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	refs := make([]*Post, len(results))
+	for i := range results {
+		refs[i] = &results[i].Post
+	}
+
+	return results, hydratePosts(ctx, s.db, viewerID, refs)
+}
+
+// Comments returns the comments matching sq on published posts viewerID may
+// see, most relevant first.
+func (s *SearchStore) Comments(ctx context.Context, viewerID int64, sq SearchQuery) ([]CommentSearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + commentColumns + `,
+			ts_rank_cd(c.search_vector, q) AS rank,
+			ts_headline(p.language, c.content, q, $5)
+		FROM comments c
+		CROSS JOIN websearch_to_tsquery($2::regconfig, $3) q
+		JOIN posts p ON p.id = c.post_id
+		JOIN users u ON u.id = c.user_id
+		WHERE c.search_vector @@ q
+			AND c.deleted_at IS NULL
+			AND p.deleted_at IS NULL
+			AND p.status = 'published'
+			AND ` + visibleTo("p", "$1") + `
+		ORDER BY rank DESC, c.id DESC
+		LIMIT $4 OFFSET $6
+	`
+
+	rows, err := s.db.QueryContext(ctx, query,
+		viewerID, sq.Language, sq.Query, sq.Limit, snippetOptions, sq.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []CommentSearchResult{}
+
+	for rows.Next() {
+		var res CommentSearchResult
+		res.Comment, err = scanComment(rows, &res.Rank, &res.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		res.Snippet = highlight(res.Snippet)
+		results = append(results, res)
+	}
+
+	return results, rows.Err()
+}
+
+// Users returns the active users whose username matches sq, most relevant
+// first. Usernames are not stemmed.
+func (s *SearchStore) Users(ctx context.Context, sq SearchQuery) ([]UserSearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT u.id, u.username, ts_rank_cd(u.search_vector, q) AS rank
+		FROM users u
+		CROSS JOIN websearch_to_tsquery('simple', $1) q
+		WHERE u.search_vector @@ q AND u.is_active
+		ORDER BY rank DESC, u.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, sq.Query, sq.Limit, sq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []UserSearchResult{}
+
+	for rows.Next() {
+		var res UserSearchResult
+		if err := rows.Scan(&res.ID, &res.Username, &res.Rank); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+
+	return results, rows.Err()
+}
@@ -8,10 +8,16 @@ import (
 )
 
 var (
-	ErrNotFound          = errors.New("record not found")
-	ErrAlredyExists      = errors.New("resource already exists")
-	ErrDuplicateEmail    = errors.New("email already exists")
-	ErrDuplicateUsername = errors.New("username already exists")
+	ErrNotFound           = errors.New("record not found")
+	ErrAlredyExists       = errors.New("resource already exists")
+	ErrDuplicateEmail     = errors.New("email already exists")
+	ErrDuplicateUsername  = errors.New("username already exists")
+	ErrConflict           = errors.New("edit conflict")
+	ErrInvalidCursor      = errors.New("invalid pagination cursor")
+	ErrPollClosed         = errors.New("poll is closed")
+	ErrInvalidVote        = errors.New("invalid poll options")
+	ErrPinLimit           = errors.New("pinned posts limit reached")
+	ErrCommentsRestricted = errors.New("comments on this post are restricted")
 )
 
 type Storage struct {
@@ -19,8 +25,30 @@ type Storage struct {
 		GetByID(context.Context, int64) (*Post, error)
 		Create(context.Context, *Post) error
 		Update(context.Context, *Post) error
-		Delete(context.Context, int64) error
+		Delete(ctx context.Context, id int64, deletedBy int64, version int) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetTopFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery, r FeedRanking, at time.Time) ([]PostWithMetadata, error)
+		GetFeedEntries(ctx context.Context, userID int64, limit int) ([]TimelineEntry, error)
+		GetByIDs(ctx context.Context, ids []int64) ([]PostWithMetadata, error)
+		HydrateFeed(ctx context.Context, viewerID int64, posts []PostWithMetadata) ([]PostWithMetadata, error)
+		GetTrash(ctx context.Context, userID int64, deletedSince time.Time) ([]Post, error)
+		Restore(ctx context.Context, id int64, userID int64, deletedSince time.Time) error
+		PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
+		GetByStatus(ctx context.Context, userID int64, status string) ([]Post, error)
+		PublishScheduled(ctx context.Context, limit int) ([]int64, error)
+		DeleteRepost(ctx context.Context, userID, originalID int64) (*Post, error)
+		Hydrate(ctx context.Context, viewerID int64, posts ...*Post) error
+		CanView(ctx context.Context, postID, viewerID int64) (bool, error)
+		CanViewPublished(ctx context.Context, postID, viewerID int64) (bool, error)
+		FilterViewers(ctx context.Context, postID int64, userIDs []int64) ([]int64, error)
+		GetMentionedIDs(ctx context.Context, postID int64) ([]int64, error)
+		GetByTag(ctx context.Context, viewerID int64, tag string, fq PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetUserPosts(ctx context.Context, viewerID, authorID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetExplore(ctx context.Context, viewerID int64, eq ExploreQuery) ([]PostWithMetadata, error)
+		GetPublicPosts(ctx context.Context, authorID int64, tag string, limit int) ([]PostWithMetadata, error)
+		GetPublicPostsChangedAt(ctx context.Context, authorID int64, tag string) (time.Time, error)
+		Pin(ctx context.Context, postID, userID int64) error
+		Unpin(ctx context.Context, postID, userID int64) error
 	}
 	Users interface {
 		GetByID(context.Context, int64) (*User, error)
@@ -32,25 +60,72 @@ type Storage struct {
 	}
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostId(context.Context, int64) ([]Comment, error)
+		GetByID(context.Context, int64) (*Comment, error)
+		GetAncestorIDs(ctx context.Context, id int64) ([]int64, error)
+		List(context.Context, CommentQuery) ([]Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(context.Context, int64) error
 	}
 	Followers interface {
 		Follow(ctx context.Context, followerId int64, userID int64) error
 		Unfollow(ctx context.Context, followerId int64, userID int64) error
 		GetFollowers(ctx context.Context, userID int64) ([]User, error)
+		GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error)
+		GetFollowerIDsAfter(ctx context.Context, userID, afterID int64, limit int) ([]int64, error)
+		IsConnected(ctx context.Context, userID, otherID int64) (bool, error)
+		FollowsPopular(ctx context.Context, userID int64, threshold int) (bool, error)
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
 	}
+	Reactions interface {
+		SetPostReaction(ctx context.Context, postID, userID int64, reaction string) (bool, error)
+		RemovePostReaction(ctx context.Context, postID, userID int64) error
+		GetPostReaction(ctx context.Context, postID, userID int64) (string, error)
+		SetCommentReaction(ctx context.Context, commentID, userID int64, reaction string) (bool, error)
+		RemoveCommentReaction(ctx context.Context, commentID, userID int64) error
+	}
+	Attachments interface {
+		Create(context.Context, *Attachment) error
+		GetByID(context.Context, int64) (*Attachment, error)
+		DeleteOrphans(ctx context.Context, createdBefore time.Time, limit int) ([]Attachment, error)
+	}
+	Bookmarks interface {
+		Add(ctx context.Context, userID, postID int64, collectionID *int64) error
+		Remove(ctx context.Context, userID, postID int64) error
+		IsBookmarked(ctx context.Context, userID, postID int64) (bool, error)
+		List(ctx context.Context, userID int64, bq BookmarkQuery) ([]Bookmark, error)
+		CreateCollection(context.Context, *BookmarkCollection) error
+		GetCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error)
+		DeleteCollection(ctx context.Context, userID, collectionID int64) error
+	}
+	Polls interface {
+		Vote(ctx context.Context, postID, userID int64, optionIDs []int64) error
+	}
+	Search interface {
+		Posts(ctx context.Context, viewerID int64, sq SearchQuery) ([]PostSearchResult, error)
+		Comments(ctx context.Context, viewerID int64, sq SearchQuery) ([]CommentSearchResult, error)
+		Users(ctx context.Context, sq SearchQuery) ([]UserSearchResult, error)
+	}
+	Tags interface {
+		GetTrending(ctx context.Context, since time.Time, limit int) ([]TrendingTag, error)
+		PruneUsage(ctx context.Context, before time.Time) (int64, error)
+	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db: db},
-		Users:     &UsersStore{db: db},
-		Comments:  &CommentStore{db: db},
-		Followers: &FollowerStore{db: db},
-		Roles:     &RoleStore{db: db},
+		Posts:       &PostStore{db: db},
+		Users:       &UsersStore{db: db},
+		Comments:    &CommentStore{db: db},
+		Followers:   &FollowerStore{db: db},
+		Roles:       &RoleStore{db: db},
+		Reactions:   &ReactionStore{db: db},
+		Bookmarks:   &BookmarkStore{db: db},
+		Attachments: &AttachmentStore{db: db},
+		Polls:       &PollStore{db: db},
+		Tags:        &TagStore{db: db},
+		Search:      &SearchStore{db: db},
 	}
 }
 
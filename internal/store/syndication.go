@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// GetPublicPosts returns the latest public posts of authorID, or of every
+// author when authorID is 0, tagged with tag when it is not empty. Plain
+// reposts are left out. Posts carry UpdatedAt and no viewer specific data,
+// as they are served to anonymous feed readers.
+func (s *PostStore) GetPublicPosts(ctx context.Context, authorID int64, tag string, limit int) ([]PostWithMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + postWithMetadataColumns + `, p.updated_at
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN post_reactions r ON FALSE
+		LEFT JOIN bookmarks b ON FALSE
+		WHERE p.visibility = 'public'
+			AND p.status = 'published'
+			AND p.deleted_at IS NULL
+			AND NOT (p.repost_of_id IS NOT NULL AND NOT p.is_quote)
+			AND ($1 = 0 OR p.user_id = $1)
+			AND ($2 = '' OR p.tags @> ARRAY[$2::varchar])
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $3
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, authorID, tag, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+
+	for rows.Next() {
+		var updatedAt string
+		post, err := scanPostWithMetadata(rows, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		post.UpdatedAt = updatedAt
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, hydratePostsWithMetadata(ctx, s.db, 0, posts)
+}
+
+// GetPublicPostsChangedAt returns when the posts GetPublicPosts lists for
+// authorID or tag last changed, posts that left the list included. It never
+// goes back, and is the zero time when nothing was ever posted there.
+func (s *PostStore) GetPublicPostsChangedAt(ctx context.Context, authorID int64, tag string) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT GREATEST(
+			(SELECT changed_at FROM user_feed_changes WHERE user_id = $1),
+			(SELECT changed_at FROM tag_feed_changes WHERE tag = $2)
+		)
+	`
+
+	var changedAt sql.NullTime
+	if err := s.db.QueryRowContext(ctx, query, authorID, tag).Scan(&changedAt); err != nil {
+		return time.Time{}, err
+	}
+
+	return changedAt.Time, nil
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type TrendingTag struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type TagStore struct {
+	db *sql.DB
+}
+
+// GetTrending returns the tags used by the most posts published since the
+// given time.
+func (s *TagStore) GetTrending(ctx context.Context, since time.Time, limit int) ([]TrendingTag, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT tag, SUM(count) AS total
+		FROM tag_usage
+		WHERE bucket >= date_trunc('hour', $1::timestamptz)
+		GROUP BY tag
+		HAVING SUM(count) > 0
+		ORDER BY total DESC, tag
+		LIMIT $2
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// PruneUsage deletes usage buckets older than the given time and returns the
+// number of rows removed.
+func (s *TagStore) PruneUsage(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM tag_usage WHERE bucket < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// GetByTag returns the published posts carrying tag that viewerID may see,
+// newest first, starting after fq.Position.
+func (s *PostStore) GetByTag(ctx context.Context, viewerID int64, tag string, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	args := []any{viewerID, tag, fq.Limit}
+
+	query := `
+		SELECT ` + postWithMetadataColumns + `
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN post_reactions r ON r.post_id = p.id AND r.user_id = $1
+		LEFT JOIN bookmarks b ON b.post_id = p.id AND b.user_id = $1
+		WHERE
+			p.tags @> ARRAY[$2::varchar]
+			AND p.deleted_at IS NULL
+			AND p.status = 'published'
+			AND ` + visibleTo("p", "$1")
+
+	if fq.Position != nil {
+		args = append(args, fq.Position.CreatedAt, fq.Position.ID)
+		query += ` AND (p.created_at, p.id) < ($4, $5)`
+	}
+
+	query += `
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $3
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPostsWithMetadata(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return posts, hydratePostsWithMetadata(ctx, s.db, viewerID, posts)
+}
+
+// recordTagUsage adds delta to the usage buckets of the tags of the given
+// posts. Only published, non-deleted posts count, so callers subtract before
+// a post leaves that state and add after it enters it.
+func recordTagUsage(ctx context.Context, tx *sql.Tx, postIDs []int64, delta int) error {
+	query := `
+		INSERT INTO tag_usage (tag, bucket, count)
+		SELECT t, date_trunc('hour', p.created_at), ($2::int * COUNT(*))::int
+		FROM posts p, unnest(p.tags) AS t
+		WHERE p.id = ANY($1) AND p.status = 'published' AND p.deleted_at IS NULL
+		GROUP BY 1, 2
+		ON CONFLICT (tag, bucket) DO UPDATE SET count = tag_usage.count + EXCLUDED.count
+	`
+
+	_, err := tx.ExecContext(ctx, query, pq.Array(postIDs), delta)
+	return err
+}
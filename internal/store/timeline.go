@@ -0,0 +1,365 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const maxPinnedPosts = 3
+
+const (
+	RankingLatest     = "latest"
+	RankingEngagement = "engagement"
+)
+
+// engagementScore ranks timeline posts (p) by reactions, comments and
+// reposts, decayed by age so that new posts can climb above older popular
+// ones.
+const engagementScore = `(
+	(SELECT COALESCE(SUM(value::int), 0) FROM jsonb_each_text(p.reaction_counts))
+	+ 2 * p.comment_count
+	+ 3 * p.repost_count
+)::float / power(EXTRACT(EPOCH FROM NOW() - p.created_at) / 3600 + 2, 1.5)`
+
+// FeedSortTop ranks the feed by score rather than by time.
+const FeedSortTop = "top"
+
+// FeedRanking weighs the signals behind the top feed. A post scores its
+// weighted reactions, comments and reposts plus the viewer's affinity with
+// its author, divided by (hours since posted + 2) ^ Gravity.
+type FeedRanking struct {
+	Reactions float64
+	Comments  float64
+	Reposts   float64
+	// Affinity weighs ln(1 + n), n being the number of times the viewer
+	// reacted to, commented on or reposted the author's posts lately.
+	Affinity float64
+	// Gravity is how fast scores decay with age.
+	Gravity float64
+	// Window leaves older posts out of the top feed.
+	Window time.Duration
+}
+
+// affinityPeriod is how far back interactions count towards affinity.
+const affinityPeriod = "30 days"
+
+type ExploreQuery struct {
+	PaginatedFeedQuery
+	Ranking string `json:"ranking" validate:"oneof=latest engagement"`
+}
+
+// timelineQuery builds the queries behind the post timelines. Every timeline
+// only lists published posts the viewer may see, hides plain reposts whose
+// original is gone, applies the PaginatedFeedQuery filters and shows an
+// item reposted several times only once (its latest entry).
+type timelineQuery struct {
+	viewerID int64
+	fq       PaginatedFeedQuery
+	// conditions are extra filters on the post (p) or the original of a
+	// plain repost (o), with placeholders allocated through arg.
+	conditions []string
+	// order is the ORDER BY clause over the timeline (p).
+	order string
+	// keyset is the condition on the de-duplicated timeline (p) set by
+	// after.
+	keyset string
+	// with holds common table expressions the timeline may refer to.
+	with []string
+	// score, when set, is computed for each timeline post (p) as p.score and
+	// read into PostWithMetadata.Score.
+	score string
+	args  []any
+}
+
+func newTimelineQuery(viewerID int64, fq PaginatedFeedQuery) *timelineQuery {
+	q := &timelineQuery{viewerID: viewerID, fq: fq}
+	q.arg(viewerID)
+	q.order = "p.created_at " + fq.Sort + ", p.id " + fq.Sort
+	return q
+}
+
+// arg binds value and returns its placeholder.
+func (q *timelineQuery) arg(value any) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *timelineQuery) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// after restricts the timeline to the entries past c in the (created_at, id)
+// order of the query's sort, replacing the offset. Prev cursors select the
+// entries before c instead, nearest first, so the caller has to reverse
+// the rows.
+func (q *timelineQuery) after(c *FeedCursor) {
+	dir := q.fq.Sort
+	if c.Prev {
+		dir = map[string]string{"asc": "desc", "desc": "asc"}[dir]
+	}
+
+	cmp := ">"
+	if dir == "desc" {
+		cmp = "<"
+	}
+
+	q.keyset = `(p.created_at, p.id) ` + cmp + ` (` + q.arg(c.CreatedAt) + `, ` + q.arg(c.ID) + `)`
+	q.order = "p.created_at " + dir + ", p.id " + dir
+	q.fq.Offset = 0
+}
+
+// rank orders the timeline by the score of r as of at, leaving out posts
+// past the ranking window. Pages start after c when there is one.
+func (q *timelineQuery) rank(r FeedRanking, at time.Time, c *FeedCursor) {
+	asOf := q.arg(at) + `::timestamptz`
+
+	q.with = append(q.with, `affinity AS (
+			SELECT i.author_id, LN(1 + COUNT(*)) AS score
+			FROM (
+				SELECT ap.user_id AS author_id
+				FROM post_reactions ar
+				JOIN posts ap ON ap.id = ar.post_id
+				WHERE ar.user_id = $1 AND ar.created_at > `+asOf+` - INTERVAL '`+affinityPeriod+`'
+				UNION ALL
+				SELECT ap.user_id
+				FROM comments ac
+				JOIN posts ap ON ap.id = ac.post_id
+				WHERE ac.user_id = $1 AND ac.deleted_at IS NULL AND ac.created_at > `+asOf+` - INTERVAL '`+affinityPeriod+`'
+				UNION ALL
+				SELECT ap.user_id
+				FROM posts ar
+				JOIN posts ap ON ap.id = ar.repost_of_id
+				WHERE ar.user_id = $1 AND ar.deleted_at IS NULL AND ar.created_at > `+asOf+` - INTERVAL '`+affinityPeriod+`'
+			) i
+			WHERE i.author_id <> $1
+			GROUP BY i.author_id
+		)`)
+
+	// plain reposts are scored by their original's engagement and author
+	q.score = `(
+					` + q.arg(r.Reactions) + `::float8 * (SELECT COALESCE(SUM(value::int), 0) FROM jsonb_each_text(COALESCE(o.reaction_counts, p.reaction_counts)))
+					+ ` + q.arg(r.Comments) + `::float8 * COALESCE(o.comment_count, p.comment_count)
+					+ ` + q.arg(r.Reposts) + `::float8 * COALESCE(o.repost_count, p.repost_count)
+					+ ` + q.arg(r.Affinity) + `::float8 * COALESCE((SELECT a.score FROM affinity a WHERE a.author_id = COALESCE(o.user_id, p.user_id)), 0)
+				) / power(EXTRACT(EPOCH FROM ` + asOf + ` - p.created_at) / 3600 + 2, ` + q.arg(r.Gravity) + `::float8)`
+
+	// posts newer than at are left for the next first page, so that they
+	// don't shift the ones being paged through
+	q.where(`p.created_at <= ` + asOf)
+	q.where(`p.created_at > ` + asOf + ` - make_interval(secs => ` + q.arg(r.Window.Seconds()) + `::float8)`)
+
+	q.order = "p.score DESC, p.id DESC"
+
+	if c != nil {
+		q.keyset = `(p.score, p.id) < (` + q.arg(c.Rank.Score) + `::float8, ` + q.arg(c.ID) + `)`
+		q.fq.Offset = 0
+	}
+}
+
+func (q *timelineQuery) build() (string, []any) {
+	fq := q.fq
+
+	if fq.Search != "" {
+		search := q.arg(fq.Search)
+		q.where(`(COALESCE(o.title, p.title) ILIKE '%' || ` + search + ` || '%' OR COALESCE(o.content, p.content) ILIKE '%' || ` + search + ` || '%')`)
+	}
+
+	if len(fq.Tags) > 0 {
+		q.where(`COALESCE(o.tags, p.tags) @> ` + q.arg(pq.Array(fq.Tags)))
+	}
+
+	if fq.Since != "" {
+		q.where(`p.created_at >= ` + q.arg(fq.Since) + `::timestamptz`)
+	}
+
+	if fq.Until != "" {
+		q.where(`p.created_at < ` + q.arg(fq.Until) + `::timestamptz`)
+	}
+
+	// Plain reposts are matched against their original (o) and share its
+	// partition, so duplicates collapse to the latest entry.
+	query := `
+		WITH `
+
+	for _, cte := range q.with {
+		query += cte + `,
+		`
+	}
+
+	query += `timeline AS (
+			SELECT p.*,`
+
+	if q.score != "" {
+		query += `
+			` + q.score + ` AS score,`
+	}
+
+	query += `
+			ROW_NUMBER() OVER (
+				PARTITION BY COALESCE(o.id, p.id)
+				ORDER BY p.created_at DESC, p.id DESC
+			) AS dup
+			FROM posts p
+			LEFT JOIN posts o ON o.id = p.repost_of_id AND NOT p.is_quote
+				AND o.deleted_at IS NULL AND o.status = 'published' AND ` + visibleTo("o", "$1") + `
+			WHERE
+				` + visibleTo("p", "$1") + `
+				AND p.deleted_at IS NULL
+				AND p.status = 'published'
+				AND (p.repost_of_id IS NULL OR p.is_quote OR o.id IS NOT NULL)
+	`
+
+	for _, condition := range q.conditions {
+		query += `
+				AND ` + condition
+	}
+
+	columns := postWithMetadataColumns
+	if q.score != "" {
+		columns += `, p.score`
+	}
+
+	query += `
+		)
+		SELECT ` + columns + `
+		FROM timeline p
+		LEFT JOIN users u ON u.id = p.user_id
+		LEFT JOIN post_reactions r ON r.post_id = p.id AND r.user_id = $1
+		LEFT JOIN bookmarks b ON b.post_id = p.id AND b.user_id = $1
+		WHERE p.dup = 1`
+
+	if q.keyset != "" {
+		query += ` AND ` + q.keyset
+	}
+
+	query += `
+		ORDER BY ` + q.order + `
+		LIMIT ` + q.arg(fq.Limit) + ` OFFSET ` + q.arg(fq.Offset)
+
+	return query, q.args
+}
+
+func (s *PostStore) queryTimeline(ctx context.Context, q *timelineQuery) ([]PostWithMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query, args := q.build()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []PostWithMetadata
+	if q.score != "" {
+		posts, err = scanRankedPosts(rows)
+	} else {
+		posts, err = scanPostsWithMetadata(rows)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return posts, hydratePostsWithMetadata(ctx, s.db, q.viewerID, posts)
+}
+
+func scanRankedPosts(rows *sql.Rows) ([]PostWithMetadata, error) {
+	posts := []PostWithMetadata{}
+
+	for rows.Next() {
+		var score float64
+		post, err := scanPostWithMetadata(rows, &score)
+		if err != nil {
+			return nil, err
+		}
+		post.Score = &score
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// GetUserPosts returns the profile timeline of authorID as seen by
+// viewerID: the author's posts and reposts, pinned posts first.
+func (s *PostStore) GetUserPosts(ctx context.Context, viewerID, authorID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	q := newTimelineQuery(viewerID, fq)
+	q.where(`p.user_id = ` + q.arg(authorID))
+	q.order = "p.pinned_at DESC NULLS LAST, " + q.order
+
+	return s.queryTimeline(ctx, q)
+}
+
+// GetExplore returns public posts across all users, leaving out plain
+// reposts. viewerID may be 0 for anonymous requests.
+func (s *PostStore) GetExplore(ctx context.Context, viewerID int64, eq ExploreQuery) ([]PostWithMetadata, error) {
+	q := newTimelineQuery(viewerID, eq.PaginatedFeedQuery)
+	q.where(`p.visibility = 'public'`)
+	q.where(`NOT (p.repost_of_id IS NOT NULL AND NOT p.is_quote)`)
+
+	if eq.Ranking == RankingEngagement {
+		q.order = engagementScore + " DESC, p.created_at DESC, p.id DESC"
+	}
+
+	return s.queryTimeline(ctx, q)
+}
+
+// Pin pins one of the user's published posts to the top of their profile.
+// Pinning an already pinned post keeps its position.
+func (s *PostStore) Pin(ctx context.Context, postID, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		// the user row serializes concurrent pins so the limit holds
+		if _, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+			return err
+		}
+
+		var pinned int
+		err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM posts
+			WHERE user_id = $1 AND pinned_at IS NOT NULL AND deleted_at IS NULL AND id <> $2
+		`, userID, postID).Scan(&pinned)
+		if err != nil {
+			return err
+		}
+
+		if pinned >= maxPinnedPosts {
+			return ErrPinLimit
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			UPDATE posts SET pinned_at = COALESCE(pinned_at, NOW())
+			WHERE id = $1 AND user_id = $2 AND status = 'published' AND deleted_at IS NULL
+		`, postID, userID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+}
+
+func (s *PostStore) Unpin(ctx context.Context, postID, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE posts SET pinned_at = NULL WHERE id = $1 AND user_id = $2`
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID)
+	return err
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Pedro-Foramilio/social/internal/markup"
+	"github.com/lib/pq"
+)
+
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityMentioned = "mentioned"
+	VisibilityPrivate   = "private"
+)
+
+// visibleTo returns a SQL predicate that holds when the post aliased as
+// alias may be seen by the user bound to the viewer placeholder. Authors
+// always see their own posts; private posts are seen by nobody else.
+func visibleTo(alias, viewer string) string {
+	return fmt.Sprintf(`(
+		%[1]s.user_id = %[2]s
+		OR %[1]s.visibility = 'public'
+		OR (%[1]s.visibility = 'followers' AND EXISTS (
+			SELECT 1 FROM followers vf WHERE vf.user_id = %[1]s.user_id AND vf.follower_id = %[2]s
+		))
+		OR (%[1]s.visibility = 'mentioned' AND EXISTS (
+			SELECT 1 FROM post_mentions vm WHERE vm.post_id = %[1]s.id AND vm.user_id = %[2]s
+		))
+	)`, alias, viewer)
+}
+
+// CanView reports whether viewerID may see the post, following the same
+// rules the feed and the other listings apply.
+func (s *PostStore) CanView(ctx context.Context, postID, viewerID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT EXISTS (SELECT 1 FROM posts p WHERE p.id = $1 AND ` + visibleTo("p", "$2") + `)`
+
+	var visible bool
+	err := s.db.QueryRowContext(ctx, query, postID, viewerID).Scan(&visible)
+	return visible, err
+}
+
+// CanViewPublished is CanView restricted to published posts that are not
+// deleted, for reads that do not go through the post itself.
+func (s *PostStore) CanViewPublished(ctx context.Context, postID, viewerID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM posts p
+			WHERE p.id = $1 AND p.deleted_at IS NULL AND p.status = 'published' AND ` + visibleTo("p", "$2") + `
+		)
+	`
+
+	var visible bool
+	err := s.db.QueryRowContext(ctx, query, postID, viewerID).Scan(&visible)
+	return visible, err
+}
+
+// FilterViewers returns the users among userIDs who may see the post.
+func (s *PostStore) FilterViewers(ctx context.Context, postID int64, userIDs []int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT v.id
+		FROM unnest($2::bigint[]) AS v(id)
+		JOIN posts p ON p.id = $1
+		WHERE ` + visibleTo("p", "v.id")
+
+	rows, err := s.db.QueryContext(ctx, query, postID, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	viewers := []int64{}
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		viewers = append(viewers, id)
+	}
+
+	return viewers, rows.Err()
+}
+
+// GetMentionedIDs returns the users mentioned in the post.
+func (s *PostStore) GetMentionedIDs(ctx context.Context, postID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id FROM post_mentions WHERE post_id = $1`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// saveMentions replaces the post's mentions with the existing users
+// mentioned as @username in content.
+func saveMentions(ctx context.Context, tx *sql.Tx, postID int64, content string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_mentions WHERE post_id = $1`, postID); err != nil {
+		return err
+	}
+
+	usernames := markup.ExtractMentions(content)
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO post_mentions (post_id, user_id)
+		SELECT $1, id FROM users WHERE username = ANY($2)
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := tx.ExecContext(ctx, query, postID, pq.Array(usernames))
+	return err
+}